@@ -0,0 +1,112 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Adaptive Throttling of the Requests per Second to each Domain
+const DEFAULT_ADAPTIVE_RPS = 10.0
+const ADAPTIVE_MIN_RPS = 0.1
+const ADAPTIVE_INCREASE = 0.5
+const ADAPTIVE_LATENCY_FACTOR = 2.0
+const ADAPTIVE_LATENCY_SAMPLES = 5
+const ADAPTIVE_LATENCY_WEIGHT = 0.2
+
+//---------------------------------------------------------------------------------------
+
+// Start Adapting the Requests per Second of the Domain, from and never above the given rate
+func (d *domainLimiter) startAdaptive(rps float64) {
+	d.adaptive = true
+	d.rps = rps
+	d.maxRPS = rps
+	d.interval = time.Duration(float64(time.Second) / rps)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Adapt the Requests per Second of the Domain from the outcome of a Request, Additively
+// Increasing the rate on each healthy Response while Multiplicatively Decreasing it when
+// the Domain is Rate Limiting, Unavailable, Timing Out or its Latency is rising
+func (d *domainLimiter) observe(hostname string, statusCode int, latency time.Duration, err error) {
+	if !d.adaptive {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// Compare the Latency against the smoothed Latency before folding it in
+	reason := throttleReason(statusCode, err)
+	if err == nil {
+		if reason == "" && d.samples >= ADAPTIVE_LATENCY_SAMPLES && float64(latency) > ADAPTIVE_LATENCY_FACTOR*float64(d.latency) {
+			reason = fmt.Sprintf("Latency %v above %v", latency.Round(time.Millisecond), d.latency.Round(time.Millisecond))
+		}
+		if d.samples == 0 {
+			d.latency = latency
+		} else {
+			d.latency = time.Duration((1-ADAPTIVE_LATENCY_WEIGHT)*float64(d.latency) + ADAPTIVE_LATENCY_WEIGHT*float64(latency))
+		}
+		d.samples++
+	}
+
+	// Decrease at most once per interval, so a burst of In-Flight Requests only counts once
+	rps := d.rps
+	now := time.Now()
+	if reason != "" {
+		if now.Sub(d.lastDecrease) < max(time.Second, d.interval) {
+			return
+		}
+		d.lastDecrease = now
+		rps = max(rps/2, ADAPTIVE_MIN_RPS)
+	} else {
+		if err != nil {
+			return
+		}
+		reason = "Healthy Response"
+		rps = min(rps+ADAPTIVE_INCREASE/rps, d.maxRPS)
+	}
+
+	if rps == d.rps {
+		return
+	}
+	d.rps = rps
+	d.interval = time.Duration(float64(time.Second) / rps)
+	logger.Debug().Str("Domain", hostname).Float64("Requests per Second", rps).Str("Reason", reason).Msg(doubleIndent)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return why the Status Code or Error calls for the Domain to be Throttled, or an empty string
+func throttleReason(statusCode int, err error) string {
+
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return fmt.Sprintf("Status Code %d", statusCode)
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "Timeout"
+	}
+
+	return ""
+}
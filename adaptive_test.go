@@ -0,0 +1,82 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDomainLimiterAdaptive(t *testing.T) {
+	d := new(domainLimiter)
+	d.startAdaptive(4)
+
+	// Rate Limiting halves the rate, a burst of In-Flight Responses only counting once
+	d.observe("example.com", http.StatusTooManyRequests, 0, nil)
+	d.observe("example.com", http.StatusServiceUnavailable, 0, nil)
+	if d.rps != 2 || d.interval != 500*time.Millisecond {
+		t.Fatalf("expected 2 requests per second at a 500ms interval, got %v at %v", d.rps, d.interval)
+	}
+
+	// Healthy Responses increase the rate additively, never above the starting rate
+	d.observe("example.com", http.StatusOK, 100*time.Millisecond, nil)
+	if d.rps != 2+ADAPTIVE_INCREASE/2 {
+		t.Errorf("expected %v requests per second, got %v", 2+ADAPTIVE_INCREASE/2, d.rps)
+	}
+	for i := 0; i < 100; i++ {
+		d.observe("example.com", http.StatusOK, 100*time.Millisecond, nil)
+	}
+	if d.rps != 4 {
+		t.Errorf("expected the rate to recover to 4 requests per second, got %v", d.rps)
+	}
+
+	// Rising Latency and Timeouts halve the rate once the cool down has passed, never below the minimum
+	d.lastDecrease = time.Time{}
+	d.observe("example.com", http.StatusOK, 500*time.Millisecond, nil)
+	if d.rps != 2 {
+		t.Errorf("expected rising latency to halve the rate to 2, got %v", d.rps)
+	}
+	for i := 0; i < 10; i++ {
+		d.lastDecrease = time.Time{}
+		d.observe("example.com", 0, 0, fmt.Errorf("Get: %w", context.DeadlineExceeded))
+	}
+	if d.rps != ADAPTIVE_MIN_RPS {
+		t.Errorf("expected timeouts to reduce the rate to %v, got %v", ADAPTIVE_MIN_RPS, d.rps)
+	}
+
+	// Other Errors leave the rate unchanged
+	d.observe("example.com", 0, 0, fmt.Errorf("connection refused"))
+	if d.rps != ADAPTIVE_MIN_RPS {
+		t.Errorf("expected the rate to be unchanged, got %v", d.rps)
+	}
+}
+
+func TestRequestLimiterAdaptiveStartingRate(t *testing.T) {
+	l := NewRequestLimiter(100, 0)
+	l.Adaptive = true
+	l.DomainRPS = 2
+	rps := 0.0
+	l.DomainLimits = []DomainLimit{{Domain: "unlimited.example.com", RPS: &rps}}
+
+	if d := l.domain("example.com"); !d.adaptive || d.rps != 2 {
+		t.Errorf("expected example.com to adapt from 2 requests per second, got %v", d.rps)
+	}
+	if d := l.domain("unlimited.example.com"); !d.adaptive || d.rps != DEFAULT_ADAPTIVE_RPS {
+		t.Errorf("expected unlimited.example.com to adapt from %v requests per second, got %v", DEFAULT_ADAPTIVE_RPS, d.rps)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// States of a URL recorded in the Checkpoint File
+const CHECKPOINT_DONE = "done"
+const CHECKPOINT_FAILED = "failed"
+
+// Checkpoint File recording the State of each URL as it completes, so an
+// interrupted crawl can be Resumed. Rows are only ever appended, the last
+// State recorded for a URL takes precedence.
+type Checkpoint struct {
+	file   *os.File
+	writer *csv.Writer
+	states map[string]string
+}
+
+//---------------------------------------------------------------------------------------
+
+// Open the named Checkpoint File, loading the State of each URL already
+// recorded when Resuming, otherwise starting a new Checkpoint File
+func OpenCheckpoint(name string, resume bool) (*Checkpoint, error) {
+
+	states := make(map[string]string)
+	if resume {
+		if err := loadCheckpoint(name, states); err != nil {
+			return nil, fmt.Errorf("[OpenCheckpoint] %w", err)
+		}
+	}
+
+	file, err := openOutputFile(name, resume)
+	if err != nil {
+		return nil, fmt.Errorf("[OpenCheckpoint] %w", err)
+	}
+
+	return &Checkpoint{file: file, writer: csv.NewWriter(file), states: states}, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Load the State of each URL recorded in the Checkpoint File, if it exists
+func loadCheckpoint(name string, states map[string]string) error {
+
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Open Checkpoint File Failed: %w", err)
+	}
+	defer file.Close()
+
+	// A crawl interrupted mid write may leave a partial last row, which is ignored
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				continue
+			}
+			return fmt.Errorf("Read Checkpoint File Failed: %w", err)
+		}
+		if len(row) >= 2 {
+			states[row[0]] = row[1]
+		}
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the State of the URL recorded in the Checkpoint File, or an empty string
+func (c *Checkpoint) State(url string) string {
+	return c.states[url]
+}
+
+//---------------------------------------------------------------------------------------
+
+// Record the State of the URL in the Checkpoint File and Flush it to disk
+func (c *Checkpoint) Record(url string, state string) error {
+
+	c.states[url] = state
+	if err := c.writer.Write([]string{url, state, time.Now().UTC().Format(time.RFC3339)}); err != nil {
+		return fmt.Errorf("[Record] Failed Writing to the File: %w", err)
+	}
+
+	c.writer.Flush()
+	if err := c.writer.Error(); err != nil {
+		return fmt.Errorf("[Record] Failed Flushing the File: %w", err)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Flush any buffered rows and Close the Checkpoint File
+func (c *Checkpoint) Close() error {
+
+	c.writer.Flush()
+	if err := c.writer.Error(); err != nil {
+		c.file.Close()
+		return fmt.Errorf("[Close] Failed Flushing the File: %w", err)
+	}
+
+	if err := c.file.Close(); err != nil {
+		return fmt.Errorf("[Close] Failed Closing the File: %w", err)
+	}
+
+	return nil
+}
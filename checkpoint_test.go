@@ -0,0 +1,144 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Data and Error Sink failing to write the Records and Failed Requests of the URLs
+// ending with /fail, keeping everything else in a Result Store
+type failingSink struct {
+	*ResultStore
+}
+
+func (s failingSink) WriteRecord(record ScrapedRecord) error {
+	if strings.HasSuffix(record.OriginalURL, "/fail") {
+		return errors.New("disk full")
+	}
+	return s.ResultStore.WriteRecord(record)
+}
+
+func (s failingSink) WriteFailure(failure FailedRequest) error {
+	if strings.HasSuffix(failure.OriginalURL, "/fail") {
+		return errors.New("disk full")
+	}
+	return s.ResultStore.WriteFailure(failure)
+}
+
+func TestCheckpointResume(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "checkpoint.csv")
+
+	// The first crawl completes one URL, fails another, then retries the failure successfully
+	checkpoint, err := OpenCheckpoint(name, false)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint failed: %v", err)
+	}
+	for _, record := range [][2]string{
+		{"https://example.com/a", CHECKPOINT_DONE},
+		{"https://example.com/b", CHECKPOINT_FAILED},
+		{"https://example.com/c", CHECKPOINT_FAILED},
+		{"https://example.com/c", CHECKPOINT_DONE},
+	} {
+		if err := checkpoint.Record(record[0], record[1]); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if err := checkpoint.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Simulate the crawl being interrupted part way through writing a row
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0o666)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if _, err := file.WriteString(`"https://example.com/d,do`); err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+	file.Close()
+
+	checkpoint, err = OpenCheckpoint(name, true)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint failed: %v", err)
+	}
+	defer checkpoint.Close()
+
+	c := &Crawler{URLs: []string{
+		"https://example.com/a",
+		"https://example.com/b",
+		"https://example.com/c",
+		"https://example.com/d",
+	}}
+	if err := c.SkipCompletedURLs(checkpoint); err != nil {
+		t.Fatalf("SkipCompletedURLs failed: %v", err)
+	}
+
+	expected := []string{"https://example.com/b", "https://example.com/d"}
+	if !reflect.DeepEqual(c.URLs, expected) {
+		t.Errorf("expected %v, got %v", expected, c.URLs)
+	}
+}
+
+func TestExecuteScrapeCheckpointsWrittenURLs(t *testing.T) {
+	server := newTestServer(t)
+
+	checkpoint, err := OpenCheckpoint(filepath.Join(t.TempDir(), "checkpoint.csv"), false)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint failed: %v", err)
+	}
+	defer checkpoint.Close()
+
+	crawler, err := NewCrawler("", "", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.Retry.MaxAttempts = 1
+	crawler.Checkpoint = checkpoint
+	crawler.URLs = []string{server.URL + "/product/1", server.URL + "/product/fail", server.URL + "/missing", server.URL + "/missing/fail"}
+
+	sink := failingSink{NewResultStore()}
+	if err := crawler.ExecuteScrape(sink, sink, nil, false, false); err == nil {
+		t.Errorf("expected the failed writes to be reported")
+	}
+
+	// Only the URLs whose Records or Failed Request were written are checkpointed
+	expected := []string{CHECKPOINT_DONE, "", CHECKPOINT_FAILED, ""}
+	for i, url := range crawler.URLs {
+		if state := checkpoint.State(url); state != expected[i] {
+			t.Errorf("%s: expected state %q, got %q", url, expected[i], state)
+		}
+	}
+}
+
+func TestCheckpointNewTruncates(t *testing.T) {
+	name := writeTestFile(t, "checkpoint.csv", "https://example.com/a,done,2024-01-02T03:04:05Z\n")
+
+	checkpoint, err := OpenCheckpoint(name, false)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint failed: %v", err)
+	}
+	defer checkpoint.Close()
+
+	if state := checkpoint.State("https://example.com/a"); state != "" {
+		t.Errorf("expected no state without resuming, got %q", state)
+	}
+}
@@ -15,39 +15,81 @@
 package main
 
 import (
-	"bufio"
-	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/gocolly/colly"
-	"github.com/itchyny/gojq"
-	"github.com/weppos/publicsuffix-go/publicsuffix"
 )
 
 const ORIGINAL_URL = "ORIGINAL_URL"
+const FETCHED_AT = "FETCHED_AT"
+const ELEMENT_INDEX = "ELEMENT_INDEX"
+const PAGE_OUTCOME = "PAGE_OUTCOME"
+const ATTEMPTS = "ATTEMPTS"
+const INPUT_COLUMNS = "INPUT_COLUMNS"
+
+// Markup Syntax each Scraped Record was extracted from
+const SYNTAX_ELEMENT = "element"
+const SYNTAX_JSONLD = "json-ld"
+const SYNTAX_MICRODATA = "microdata"
+const SYNTAX_RDFA = "rdfa"
+const SYNTAX_META = "meta"
 
 type Crawler struct {
-	Collector         *colly.Collector
-	elementSelector   string
-	jqSelector        string
-	URLs              []string
-	FailedRequestURLs []string
-	ScrapedData       []string
-	randSeed          *rand.Rand
+	Collector        *colly.Collector
+	elementSelector  string
+	jq               *JQSelector
+	JQResults        string
+	Retry            RetryPolicy
+	Limiter          *RequestLimiter
+	Robots           *RobotsPolicy
+	Follow           FollowPolicy
+	Checkpoint       *Checkpoint
+	Allowed          *DomainSet
+	Input            URLReader
+	InputColumns     []string
+	InputLayout      InputLayout
+	inputs           map[string]InputColumns
+	ShutdownTimeout  time.Duration
+	URLs             []string
+	ExtractJSONLD    bool
+	ExpandGraph      bool
+	ExtractMicrodata bool
+	ExtractRDFa      bool
+	ExtractMeta      bool
+	dataSink         DataSink
+	errorSink        ErrorSink
+	rejectSink       RejectSink
+	sinkLock         sync.Mutex
+	sinkErr          error
+	unwritten        map[string]bool
+	failureSummary   FailureSummary
+	completed        map[string]bool
+	sinksDetached    bool
+	stopping         chan struct{}
+	stopOnce         sync.Once
+	followLock       sync.Mutex
+	visited          map[string]bool
+	discovered       []string
 }
 
 //---------------------------------------------------------------------------------------
 
-// Return New Instance of a Crawler with an Embedded Colly Collector
-func NewCrawler(elementSelector string, jqSelector string, waitTime int, parallelism int) *Crawler {
+// Return New Instance of a Crawler with an Embedded Colly Collector, the jq
+// Selector is Compiled once up front so any error is reported before crawling
+func NewCrawler(elementSelector string, jqSelector string, jqDefinitions string, jqArgs JQArgs, waitTime int, parallelism int) (*Crawler, error) {
+
+	// Compile the jq Selector
+	jq, err := NewJQSelector(jqSelector, jqDefinitions, jqArgs)
+	if err != nil {
+		return nil, fmt.Errorf("[NewCrawler] Invalid jq Selector: %w", err)
+	}
 
 	// Initialise New Crawler
 	c := new(Crawler)
@@ -55,64 +97,75 @@ func NewCrawler(elementSelector string, jqSelector string, waitTime int, paralle
 		colly.UserAgent(USER_AGENTS[0]),
 		colly.MaxDepth(1),
 		colly.Async(true),
+		// robots.txt is handled by the Robots Policy, so each Disallowed URL is reported
+		colly.IgnoreRobotsTxt(),
 	)
-	_ = c.Collector.Limit(&colly.LimitRule{
-		DomainGlob:  "*",
-		Parallelism: parallelism,
-		RandomDelay: time.Millisecond * time.Duration(waitTime),
-	})
-	c.Collector.SetRequestTimeout(120 * time.Second)
-	c.Collector.WithTransport(&http.Transport{
+	// The Request Timeout is applied once the Request Limiter allows the Request, not to the wait for it
+	c.Collector.SetRequestTimeout(0)
+	c.stopping = make(chan struct{})
+	c.Limiter = NewRequestLimiter(parallelism, time.Millisecond*time.Duration(waitTime))
+	transport := &http.Transport{
 		DisableKeepAlives: true,
+	}
+	c.Robots = NewRobotsPolicy(transport)
+	c.Allowed = NewDomainSet()
+	c.Collector.WithTransport(&shutdownTransport{
+		RoundTripper: &domainTransport{
+			RoundTripper: &robotsTransport{
+				RoundTripper: &limitTransport{
+					RoundTripper: transport,
+					limiter:      c.Limiter,
+					timeout:      REQUEST_TIMEOUT,
+					stopping:     c.stopping,
+				},
+				robots:  c.Robots,
+				limiter: c.Limiter,
+			},
+			allowed: c.Allowed,
+		},
+		stopping: c.stopping,
 	})
 	c.elementSelector = elementSelector
-	c.jqSelector = jqSelector
-	c.randSeed = rand.New(rand.NewSource(time.Now().UnixNano()))
+	c.jq = jq
+	c.JQResults = JQ_RESULTS_FIRST
+	c.Retry = DefaultRetryPolicy()
+	c.ShutdownTimeout = time.Millisecond * DEFAULT_SHUTDOWN_TIMEOUT
 
-	return c
+	return c, nil
 }
 
 //---------------------------------------------------------------------------------------
 
-// Load all URLs from the first column of the provided CSV File
-func (c *Crawler) LoadUrlFile(name string, delimiter string) error {
+// Load all URLs from the provided Input File, or stdin when named "-", along with
+// the Columns of each URL to Pass Through to the Output
+func (c *Crawler) LoadUrlFile(name string, options InputOptions) error {
 
 	logger.Info().Msgf("%s Loading URL List", indent)
 
-	// Check file exists
-	if _, err := os.Stat(name); err != nil {
-		return fmt.Errorf("[LoadUrlFile] File Does Not Exist: %w", err)
-	}
-	filename, _ := filepath.Abs(name)
-
-	// Open file ready for reading
-	file, err := os.Open(filename)
+	reader, err := OpenURLReader(name, options)
 	if err != nil {
-		return fmt.Errorf("[LoadUrlFile] Open File Failed: %w", err)
+		return fmt.Errorf("[LoadUrlFile] %w", err)
 	}
-	defer file.Close()
-
-	// Configure CSV reader
-	reader := csv.NewReader(file)
-	reader.Comma = rune(delimiter[0])
-
-	// Read all the records
-	allRecords, err := reader.ReadAll()
-	if err != nil {
-		return fmt.Errorf("[LoadUrlFile] CSV Reader Failed: %w", err)
+	defer reader.Close()
+	c.InputColumns = reader.Columns()
+	c.InputLayout = reader.Layout()
+
+	// Read each URL in turn whilst ensuring to deduplicate the final URL list,
+	// keeping the Columns of the first row of a duplicated URL
+	if c.inputs == nil {
+		c.inputs = make(map[string]InputColumns)
 	}
-
-	// Iterate through each record and retrieve the URL, or value from the
-	// first column, whilst ensuring to deduplicate the final URL list
-	bucket := make(map[string]bool)
-	for _, value := range allRecords {
-		// Only process if the record contains at least one column
-		if len(value) > 0 {
-			url := value[0]
-			if _, ok := bucket[url]; !ok {
-				bucket[url] = true
-				c.URLs = append(c.URLs, url)
-			}
+	for {
+		input, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("[LoadUrlFile] %w", err)
+		}
+		if _, ok := c.inputs[input.URL]; !ok {
+			c.inputs[input.URL] = input.Columns
+			c.URLs = append(c.URLs, input.URL)
 		}
 	}
 
@@ -146,6 +199,35 @@ func (c *Crawler) DeduplicateURLs() error {
 
 //---------------------------------------------------------------------------------------
 
+// Remove the URLs the Checkpoint records as already done, those which
+// previously failed are kept so they are retried
+func (c *Crawler) SkipCompletedURLs(checkpoint *Checkpoint) error {
+
+	logger.Info().Msgf("%s Skipping Completed URLs", indent)
+
+	var remaining []string
+	completed, failed := 0, 0
+	for _, url := range c.URLs {
+		switch checkpoint.State(url) {
+		case CHECKPOINT_DONE:
+			completed++
+			continue
+		case CHECKPOINT_FAILED:
+			failed++
+		}
+		remaining = append(remaining, url)
+	}
+
+	logger.Info().Int("Completed", completed).Int("Retrying Failed", failed).Int("Remaining", len(remaining)).Msg(doubleIndent)
+
+	// Replace the Crawler URL list with the remaining list
+	c.URLs = remaining
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
 // Shuffle the list of URLs
 func (c *Crawler) ShuffleURLs() error {
 
@@ -161,81 +243,67 @@ func (c *Crawler) ShuffleURLs() error {
 
 //---------------------------------------------------------------------------------------
 
-// Populate the Collector Allowed Domains
+// Populate the Allowed Domains from the URL List
 func (c *Crawler) SetAllowedDomains(scrapeGoogleWebCache bool) error {
 
-	// Define a hash map and domain array list
-	bucket := make(map[string]bool)
-	var allowedDomains []string
-
 	logger.Info().Msgf("%s Allowed Domain List", indent)
 
-	// Iterate through the URL list and create a deduped domain list
+	// Iterate through the URL list adding the domain name and hostname of each
 	for _, rawURL := range c.URLs {
-		// Parse URL and trieve the hostname
-		u, err := url.Parse(rawURL)
-		if err != nil {
-			return fmt.Errorf("[SetAllowedDomains] URL Parse Failed: %w", err)
-		}
-		hostname := u.Hostname()
-
-		// Parse the domain name from the hostname
-		domain, err := publicsuffix.Domain(hostname)
-		if err != nil {
-			return fmt.Errorf("[SetAllowedDomains] Domain Parse Failed: %w", err)
-		}
-
-		// Add domain name, e.g. google.com
-		if _, ok := bucket[domain]; !ok {
-			bucket[domain] = true
-			allowedDomains = append(allowedDomains, domain)
-			logger.Info().Str("allowed", domain).Msg(doubleIndent)
-		}
-
-		// Add hostname, e.g. www.google.com
-		if _, ok := bucket[hostname]; !ok {
-			bucket[hostname] = true
-			allowedDomains = append(allowedDomains, hostname)
-			logger.Info().Str("allowed", hostname).Msg(doubleIndent)
+		if err := c.Allowed.AddURL(rawURL); err != nil {
+			return fmt.Errorf("[SetAllowedDomains] %w", err)
 		}
 	}
 
 	// Add Google's Web Cache Domains if required
 	if scrapeGoogleWebCache {
-		allowedDomains = append(allowedDomains, "google.com")
-		allowedDomains = append(allowedDomains, "www.google.com")
-		allowedDomains = append(allowedDomains, "googleusercontent.com")
-		allowedDomains = append(allowedDomains, "webcache.googleusercontent.com")
+		c.Allowed.Add("google.com")
+		c.Allowed.Add("www.google.com")
+		c.Allowed.Add("googleusercontent.com")
+		c.Allowed.Add("webcache.googleusercontent.com")
 	}
 
-	// Set the Collector Allowed Domain List
-	c.Collector.AllowedDomains = allowedDomains
-
 	return nil
 }
 
 //---------------------------------------------------------------------------------------
 
-// Execute Scraping of URLs
-func (c *Crawler) ExecuteScrape(scrapeXML bool, scrapeGoogleWebCache bool) error {
+// Execute Scraping of URLs, Streaming the Results to the Data, Error and Reject Sinks
+// as they arrive. The Reject Sink is Optional and may be nil.
+func (c *Crawler) ExecuteScrape(dataSink DataSink, errorSink ErrorSink, rejectSink RejectSink, scrapeXML bool, scrapeGoogleWebCache bool) error {
 	defer timer("Colly Collection")()
 
-	// Initialise Scraped Data Output
-	c.ScrapedData = make([]string, 0)
+	c.dataSink = dataSink
+	c.errorSink = errorSink
+	c.rejectSink = rejectSink
+	c.failureSummary = make(FailureSummary)
+	c.completed = make(map[string]bool)
+	c.unwritten = make(map[string]bool)
+	c.visited = make(map[string]bool)
+	for _, rawURL := range c.URLs {
+		c.visited[rawURL] = true
+	}
+	if c.inputs == nil {
+		c.inputs = make(map[string]InputColumns)
+	}
 
 	logger.Info().Msgf("%s Colly Collection Started", indent)
 
 	// Executed on every request made by the Colly Collector
 	c.Collector.OnRequest(func(r *colly.Request) {
-		r.Headers.Set("User-Agent", USER_AGENTS[c.randSeed.Intn(len(USER_AGENTS))])
+		attempts, _ := r.Ctx.GetAny(ATTEMPTS).(int)
+		r.Ctx.Put(ATTEMPTS, attempts+1)
+		r.Headers.Set("User-Agent", USER_AGENTS[rand.Intn(len(USER_AGENTS))])
 		r.Headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
 		r.Headers.Set("Accept-Language", "en-US,en;q=0.9")
 		r.Headers.Set("Accept-Encoding", "gzip, deflate")
-		r.Ctx.Put(ORIGINAL_URL, r.URL.String())
 	})
 
 	// Executed on every response received
 	c.Collector.OnResponse(func(r *colly.Response) {
+		r.Ctx.Put(FETCHED_AT, time.Now().UTC())
+		r.Ctx.Put(ELEMENT_INDEX, 0)
+		r.Ctx.Put(PAGE_OUTCOME, &pageOutcome{})
 		originalURL := r.Request.Ctx.Get(ORIGINAL_URL)
 		logger.Info().Int("Status Code", r.StatusCode).Str("Visited", originalURL).Msg(doubleIndent)
 	})
@@ -244,29 +312,93 @@ func (c *Crawler) ExecuteScrape(scrapeXML bool, scrapeGoogleWebCache bool) error
 	if scrapeXML {
 		// Executed on every XML element matched by the xpath Query parameter
 		c.Collector.OnXML(c.elementSelector, func(element *colly.XMLElement) {
-			c.ScrapedData = append(c.ScrapedData, element.Text)
+			c.writeRecord(newScrapedRecord(element.Response, SYNTAX_ELEMENT, element.Text))
+			pageOutcomeOf(element.Response).records++
 		})
 	} else {
 		// Executed on every HTML element matched by the GoQuery Selector
-		c.Collector.OnHTML(c.elementSelector, func(element *colly.HTMLElement) {
+		if c.elementSelector != "" {
+			c.Collector.OnHTML(c.elementSelector, func(element *colly.HTMLElement) {
+
+				// Record the Element Index before the jq Selector potentially discards the Element
+				record := newScrapedRecord(element.Response, SYNTAX_ELEMENT, "")
+
+				// Parse the Element Text as JSON when Expanding the @graph and top level Arrays
+				if c.ExpandGraph {
+					values, err := parseJSONLD(element.Text)
+					if err != nil {
+						logger.Error().Err(err).Str("Visited", record.OriginalURL).Msg(doubleIndent)
+						pageOutcomeOf(element.Response).reject(REJECT_INVALID_JSON, err)
+					}
+					c.scrapeValues(element.Response, record, values)
+					return
+				}
+
+				// Execute the jq Selector, still writing any values selected before an error
+				textSelected, err := c.jq.SelectText(element.Text, record.OriginalURL, c.JQResults)
+				c.writeSelected(element.Response, record, textSelected, err)
+			})
+		}
 
-			// Execute the jq Selector
-			textSelected, err := jqSelect(element.Text, c.jqSelector)
-			if err != nil {
-				logger.Error().Err(fmt.Errorf("jq Selector Failed: %w", err)).Msg(doubleIndent)
-				return
-			}
+		// Executed on every Script Block when natively extracting the JSON-LD
+		if c.ExtractJSONLD {
+			c.Collector.OnHTML(JSONLD_SELECTOR, c.scrapeJSONLD)
+		}
 
-			if len(textSelected) > 0 {
-				c.ScrapedData = append(c.ScrapedData, textSelected)
-			}
-		})
+		// Executed once per HTML document when extracting the Microdata, RDFa or Meta Tags
+		if c.ExtractMicrodata || c.ExtractRDFa || c.ExtractMeta {
+			c.Collector.OnHTML("html", c.scrapeStructuredData)
+		}
+
+		// Executed on every Link when Following Links
+		if c.Follow.MaxDepth > 0 {
+			c.Collector.OnHTML("a[href]", c.followLink)
+		}
 	}
 
+	// Executed once all of the Elements of a Page have been Scraped
+	c.Collector.OnScraped(func(r *colly.Response) {
+		if page, ok := pageOutcomeOf(r).rejectedPage(r); ok {
+			logger.Debug().Str("Reason", page.Reason).Int("Records", page.Records).Int("Rejected", page.Rejected).Str("Visited", page.OriginalURL).Msg(doubleIndent)
+			c.writeRejected(page)
+		}
+		c.recordCompleted(r.Request.Ctx.Get(ORIGINAL_URL), CHECKPOINT_DONE)
+		releaseStreamSlot(r.Request.Ctx)
+	})
+
 	// Executed if an error occurs during the HTTP request
 	c.Collector.OnError(func(r *colly.Response, err error) {
 		originalURL := r.Request.Ctx.Get(ORIGINAL_URL)
-		c.FailedRequestURLs = append(c.FailedRequestURLs, originalURL)
+		attempts, _ := r.Ctx.GetAny(ATTEMPTS).(int)
+
+		// Leave the URL Pending when the Request was dropped, or would be Retried, as the Crawl is Stopping
+		if errors.Is(err, ErrShutdown) || (c.Stopped() && c.Retry.shouldRetry(attempts, r.StatusCode, err)) {
+			logger.Debug().Err(err).Str("Visited", originalURL).Msg(doubleIndent)
+			releaseStreamSlot(r.Request.Ctx)
+			return
+		}
+
+		// Retry a transient failure after backing off, the Request Context and so the attempts are shared
+		if c.Retry.shouldRetry(attempts, r.StatusCode, err) {
+			delay := c.Retry.delay(attempts, r.Headers)
+			logger.Warn().Int("Status Code", r.StatusCode).Err(err).Int("Attempt", attempts).Dur("Retry In", delay).Str("Visited", originalURL).Msg(doubleIndent)
+
+			// Leave the URL Pending rather than Retry it should the Crawl be Stopped while backing off
+			select {
+			case <-time.After(delay):
+			case <-c.stopping:
+				logger.Debug().Err(err).Str("Visited", originalURL).Msg(doubleIndent)
+				return
+			}
+			retryErr := r.Request.Retry()
+			if retryErr == nil {
+				return
+			}
+			logger.Error().Err(retryErr).Str("Visited", originalURL).Msg(doubleIndent)
+		}
+
+		c.writeFailure(newFailedRequest(originalURL, r.StatusCode, err, attempts))
+		releaseStreamSlot(r.Request.Ctx)
 		logger.Error().Int("Status Code", r.StatusCode).Err(err).Str("Visited", originalURL).Msg(doubleIndent)
 		logger.Debug().Any("Response", r).Msg(doubleIndent)
 	})
@@ -274,123 +406,301 @@ func (c *Crawler) ExecuteScrape(scrapeXML bool, scrapeGoogleWebCache bool) error
 	// Iterate through the URL List and add to the Collector queue for a Visit
 	for _, rawURL := range c.URLs {
 
-		// If requesting to Scrape Google's Cached Version, change the URL here after the original was stored in the Request Context
-		if scrapeGoogleWebCache {
-			rawURL = fmt.Sprintf("https://webcache.googleusercontent.com/search?q=%s", url.QueryEscape(fmt.Sprintf("cache:%s", rawURL)))
+		// Stop queueing once the Crawl is Stopped, the remaining URLs are left Pending
+		if c.Stopped() {
+			break
 		}
+		c.visit(rawURL, c.inputs[rawURL], colly.NewContext(), scrapeGoogleWebCache)
+	}
 
-		_ = c.Collector.Visit(rawURL)
+	// Then Stream the URLs from the Input, if provided, still waiting for those already queued on an error
+	inputErr := c.streamInput(scrapeGoogleWebCache)
+	if !c.waitForCollector() {
+		logger.Warn().Msgf("%s Shutdown Timeout Reached, Discarding the Results of In-Flight Requests", indent)
 	}
-	c.Collector.Wait()
 
 	logger.Info().Msgf("%s Colly Collection Finished", indent)
+	c.sinkLock.Lock()
+	defer c.sinkLock.Unlock()
+	c.failureSummary.Log()
+
+	// Report the first failure to write to the Output Sinks
+	if c.sinkErr != nil {
+		return fmt.Errorf("[ExecuteScrape] Writing Output Failed: %w", c.sinkErr)
+	}
+	if inputErr != nil {
+		return fmt.Errorf("[ExecuteScrape] Reading Input Failed: %w", inputErr)
+	}
+	if c.Stopped() {
+		return fmt.Errorf("[ExecuteScrape] %w", ErrShutdown)
+	}
 
 	return nil
 }
 
 //---------------------------------------------------------------------------------------
 
-// Write the Scraped Data out to a File
-func (c *Crawler) WriteDataFile(name string, delimiter string) error {
+// Add the URL to the Collector queue for a Visit, along with any Columns to Pass Through,
+// returning false if the URL was Rejected before the request was made, in which case it
+// is recorded as a Failed Request
+func (c *Crawler) visit(rawURL string, columns InputColumns, ctx *colly.Context, scrapeGoogleWebCache bool) bool {
+
+	// Store the Original URL in the Request Context before any change is made to the URL
+	ctx.Put(ORIGINAL_URL, rawURL)
+	if columns != nil {
+		ctx.Put(INPUT_COLUMNS, columns)
+	}
 
-	logger.Info().Msgf("%s Writing Scraped Data Output File", indent)
+	// If requesting to Scrape Google's Cached Version, change the URL here after the original was stored in the Request Context
+	if scrapeGoogleWebCache {
+		rawURL = fmt.Sprintf("https://webcache.googleusercontent.com/search?q=%s", url.QueryEscape(fmt.Sprintf("cache:%s", rawURL)))
+	}
 
-	// Open file ready for writing
-	file, err := os.Create(name)
+	// Record any URL Rejected before making the request, such as a disallowed domain
+	err := c.Allowed.check(rawURL)
+	if err == nil {
+		err = c.Collector.Request("GET", rawURL, nil, ctx, nil)
+	}
 	if err != nil {
-		return fmt.Errorf("[WriteDataFile] Create File Failed: %w", err)
+		originalURL := ctx.Get(ORIGINAL_URL)
+		c.writeFailure(newFailedRequest(originalURL, 0, err, 0))
+		logger.Error().Err(err).Str("Visited", originalURL).Msg(doubleIndent)
+		return false
 	}
-	defer file.Close()
 
-	// Ready the CSV Writer and use a buffered io writer
-	w := csv.NewWriter(bufio.NewWriter(file))
-	w.Comma = rune(delimiter[0])
-	defer w.Flush()
+	return true
+}
+
+//---------------------------------------------------------------------------------------
 
-	// Iterate through the Scraped Data and Write to file
-	for _, data := range c.ScrapedData {
+// Write the Scraped Record to the Data Sink, serialising the concurrent Collector callbacks
+func (c *Crawler) writeRecord(record ScrapedRecord) {
+	c.sinkLock.Lock()
+	defer c.sinkLock.Unlock()
 
-		var row []string = make([]string, 1)
-		row[0] = strings.Replace(data, "\n", "", -1)
+	if c.sinksDetached {
+		return
+	}
 
-		if err := w.Write(row); err != nil {
-			return fmt.Errorf("[WriteDataFile] Failed Writing to the File: %w", err)
+	if err := c.dataSink.WriteRecord(record); err != nil {
+		logger.Error().Err(err).Str("Visited", record.OriginalURL).Msg(doubleIndent)
+		if c.sinkErr == nil {
+			c.sinkErr = err
 		}
+		c.unwritten[record.OriginalURL] = true
 	}
+}
 
-	return nil
+//---------------------------------------------------------------------------------------
+
+// Write the Failed Request to the Error Sink, count it in the Failure Summary and
+// record the URL as Completed, serialising the concurrent Collector callbacks
+func (c *Crawler) writeFailure(failure FailedRequest) {
+	c.sinkLock.Lock()
+	defer c.sinkLock.Unlock()
+
+	if c.sinksDetached {
+		return
+	}
+
+	c.failureSummary.Add(failure)
+
+	if err := c.errorSink.WriteFailure(failure); err != nil {
+		logger.Error().Err(err).Str("Visited", failure.OriginalURL).Msg(doubleIndent)
+		if c.sinkErr == nil {
+			c.sinkErr = err
+		}
+		return
+	}
+
+	// Only complete the URL once the Failed Request has been written
+	c.recordCompletedLocked(failure.OriginalURL, CHECKPOINT_FAILED)
 }
 
 //---------------------------------------------------------------------------------------
 
-// Write the Failed Request URLs out to a File
-func (c *Crawler) WriteErrorFile(name string, delimiter string) error {
+// Record the URL as Completed along with its State in the Checkpoint, if provided,
+// serialising the concurrent Collector callbacks
+func (c *Crawler) recordCompleted(originalURL string, state string) {
+	c.sinkLock.Lock()
+	defer c.sinkLock.Unlock()
 
-	logger.Info().Msgf("%s Writing Failed Request URLs Output File", indent)
+	if c.sinksDetached {
+		return
+	}
+	c.recordCompletedLocked(originalURL, state)
+}
 
-	// Open file ready for writing
-	file, err := os.Create(name)
+//---------------------------------------------------------------------------------------
+
+// Record the URL as Completed along with its State in the Checkpoint, if provided,
+// unless a Record Scraped from it could not be written, leaving it Pending so it is
+// Scraped again. The Sink Lock must be held.
+func (c *Crawler) recordCompletedLocked(originalURL string, state string) {
+	if c.unwritten[originalURL] {
+		return
+	}
+	c.completed[originalURL] = true
+	if c.Checkpoint == nil {
+		return
+	}
+
+	if err := c.Checkpoint.Record(originalURL, state); err != nil {
+		logger.Error().Err(err).Str("Visited", originalURL).Msg(doubleIndent)
+		if c.sinkErr == nil {
+			c.sinkErr = err
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Write the Rejected Page to the Reject Sink, if provided, serialising the concurrent Collector callbacks
+func (c *Crawler) writeRejected(page RejectedPage) {
+	if c.rejectSink == nil {
+		return
+	}
+
+	c.sinkLock.Lock()
+	defer c.sinkLock.Unlock()
+
+	if c.sinksDetached {
+		return
+	}
+	if err := c.rejectSink.WriteRejected(page); err != nil {
+		logger.Error().Err(err).Str("Visited", page.OriginalURL).Msg(doubleIndent)
+		if c.sinkErr == nil {
+			c.sinkErr = err
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Scrape each top level JSON value found in a JSON-LD Script Block as a separate Record
+func (c *Crawler) scrapeJSONLD(element *colly.HTMLElement) {
+
+	// Ignore any Script Block which does not contain JSON-LD
+	if !isJSONLDType(element.Attr("type")) {
+		return
+	}
+
+	// Record the Element Index before the JSON-LD is parsed, so all values share the Script Block index
+	record := newScrapedRecord(element.Response, SYNTAX_JSONLD, "")
+
+	// Parse the Script Block, keeping any values parsed before an error
+	values, err := parseJSONLD(element.Text)
 	if err != nil {
-		return fmt.Errorf("[WriteErrorFile] Create File Failed: %w", err)
+		logger.Error().Err(err).Str("Visited", record.OriginalURL).Msg(doubleIndent)
+		pageOutcomeOf(element.Response).reject(REJECT_INVALID_JSON, err)
 	}
-	defer file.Close()
 
-	// Ready the CSV Writer and use a buffered io writer
-	w := csv.NewWriter(bufio.NewWriter(file))
-	w.Comma = rune(delimiter[0])
-	defer w.Flush()
+	c.scrapeValues(element.Response, record, values)
+}
 
-	// Iterate through the Scraped Data and Write to file
-	for _, data := range c.FailedRequestURLs {
+//---------------------------------------------------------------------------------------
 
-		var row []string = make([]string, 1)
-		row[0] = strings.Replace(data, "\n", "", -1)
+// Scrape each top level Microdata item and RDFa resource found in the document
+// as a separate Record, shaped as JSON-LD so the jq Selector applies unchanged,
+// along with a single Record holding the Meta Tags of the document
+func (c *Crawler) scrapeStructuredData(element *colly.HTMLElement) {
 
-		if err := w.Write(row); err != nil {
-			return fmt.Errorf("[WriteErrorFile] Failed Writing to the File: %w", err)
+	if c.ExtractMicrodata {
+		for _, item := range extractMicrodata(element.DOM, element.Request.URL) {
+			c.scrapeValues(element.Response, newScrapedRecord(element.Response, SYNTAX_MICRODATA, ""), []any{item})
 		}
 	}
 
-	return nil
+	if c.ExtractRDFa {
+		for _, item := range extractRDFa(element.DOM, element.Request.URL) {
+			c.scrapeValues(element.Response, newScrapedRecord(element.Response, SYNTAX_RDFA, ""), []any{item})
+		}
+	}
+
+	if c.ExtractMeta {
+		if item := extractMeta(element.DOM, element.Request.URL); len(item) > 0 {
+			c.scrapeValues(element.Response, newScrapedRecord(element.Response, SYNTAX_META, ""), []any{item})
+		}
+	}
 }
 
 //---------------------------------------------------------------------------------------
 
-// Execute the 'jq' Selector against the JSON Object text returned
-func jqSelect(selectedText string, query string) (string, error) {
+// Execute the jq Selector against each JSON value and write a Record tagged
+// with its @type, Expanding the @graph and top level Arrays when requested
+func (c *Crawler) scrapeValues(r *colly.Response, record ScrapedRecord, values []any) {
 
-	// If the JSON Selector Query was NOT provided then return the element text
-	if query == "" {
-		return selectedText, nil
+	if c.ExpandGraph {
+		var expanded []any
+		for _, value := range values {
+			expanded = append(expanded, expandJSONLD(value)...)
+		}
+		values = expanded
 	}
 
-	// Convert the element text to a JSON Object before querying
-	var jsonData map[string]any
-	if err := json.Unmarshal([]byte(selectedText), &jsonData); err != nil {
-		return "", fmt.Errorf("Selected Element Text is not a valid JSON Object: %w", err)
+	for _, value := range values {
+
+		// Execute the jq Selector, still writing any values selected before an error
+		textSelected, err := c.jq.SelectValue(value, record.OriginalURL, c.JQResults)
+		record.Type = jsonldType(value)
+		c.writeSelected(r, record, textSelected, err)
 	}
+}
 
-	// Parse the provided jq selector text
-	jq, err := gojq.Parse(query)
+//---------------------------------------------------------------------------------------
+
+// Write a Record for each non empty value selected, counting the Element or
+// JSON value as Rejected in the Page Outcome if the jq Selector failed or
+// selected nothing
+func (c *Crawler) writeSelected(r *colly.Response, record ScrapedRecord, textSelected []string, err error) {
+
+	outcome := pageOutcomeOf(r)
 	if err != nil {
-		return "", fmt.Errorf("jq Selector Parse Failed: %w", err)
+		logger.Error().Err(fmt.Errorf("jq Selector Failed: %w", err)).Str("Visited", record.OriginalURL).Msg(doubleIndent)
+		if errors.Is(err, ErrInvalidJSON) {
+			outcome.reject(REJECT_INVALID_JSON, err)
+		} else {
+			outcome.reject(REJECT_JQ_ERROR, err)
+		}
 	}
 
-	// Execute the jq Selector against the element text only returning the first value
-	jqSelector := jq.Run(jsonData)
-	val, ok := jqSelector.Next()
-	if !ok {
-		return "", nil
+	written := 0
+	for _, text := range textSelected {
+		if len(text) > 0 {
+			record.Data = text
+			c.writeRecord(record)
+			written++
+		}
 	}
 
-	// Check if the first value returned is actually an error
-	if err, ok := val.(error); ok {
-		return "", fmt.Errorf("jq Selector Run Failed: %w", err)
+	outcome.records += written
+	if written == 0 && err == nil {
+		outcome.reject(REJECT_NO_VALUE, nil)
 	}
+}
+
+//---------------------------------------------------------------------------------------
 
-	// Convert the first value returned to a raw JSON string and return
-	rawJSON, _ := json.Marshal(val)
-	return string(rawJSON), nil
+// Return a new Scraped Record populated with the details of the Page and the next Element Index
+func newScrapedRecord(r *colly.Response, syntax string, data string) ScrapedRecord {
+
+	// Retrieve and increment the Element Index for the Page
+	index, _ := r.Ctx.GetAny(ELEMENT_INDEX).(int)
+	r.Ctx.Put(ELEMENT_INDEX, index+1)
+
+	fetchedAt, _ := r.Ctx.GetAny(FETCHED_AT).(time.Time)
+	columns, _ := r.Ctx.GetAny(INPUT_COLUMNS).(InputColumns)
+
+	return ScrapedRecord{
+		OriginalURL:  r.Ctx.Get(ORIGINAL_URL),
+		FinalURL:     r.Request.URL.String(),
+		StatusCode:   r.StatusCode,
+		FetchedAt:    fetchedAt,
+		ElementIndex: index,
+		Syntax:       syntax,
+		Data:         data,
+		Input:        columns,
+	}
 }
 
 //---------------------------------------------------------------------------------------
@@ -0,0 +1,296 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Start a local HTTP Server returning a Product page with two JSON-LD
+// script blocks for /product/ paths and a 404 for everything else
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/product/") {
+			http.NotFound(w, r)
+			return
+		}
+		sku := strings.TrimPrefix(r.URL.Path, "/product/")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<html><head>
+<script type="application/ld+json">{"@type": "Product", "sku": "%s"}</script>
+<script type="application/ld+json">{"@type": "Offer", "sku": "%s-offer"}</script>
+</head><body></body></html>`, sku, sku)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeHighParallelism(t *testing.T) {
+	const pageCount = 300
+
+	server := newTestServer(t)
+	crawler, err := NewCrawler(`script[type="application/ld+json"]`, ".sku", "", nil, 0, 100)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	for i := 0; i < pageCount; i++ {
+		crawler.URLs = append(crawler.URLs, fmt.Sprintf("%s/product/%d", server.URL, i))
+		crawler.URLs = append(crawler.URLs, fmt.Sprintf("%s/missing/%d", server.URL, i))
+	}
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	// Every Product page yields two records, one per JSON-LD script block
+	scraped := results.ScrapedData()
+	if len(scraped) != pageCount*2 {
+		t.Fatalf("expected %d scraped records, got %d", pageCount*2, len(scraped))
+	}
+
+	seen := make(map[string]bool)
+	for _, record := range scraped {
+		if seen[record.Data] {
+			t.Errorf("duplicate scraped record %s", record.Data)
+		}
+		seen[record.Data] = true
+
+		sku := strings.TrimSuffix(strings.Trim(record.Data, `"`), "-offer")
+		if record.OriginalURL != fmt.Sprintf("%s/product/%s", server.URL, sku) {
+			t.Errorf("record %s has unexpected original URL %s", record.Data, record.OriginalURL)
+		}
+		if record.StatusCode != http.StatusOK {
+			t.Errorf("record %s has unexpected status code %d", record.Data, record.StatusCode)
+		}
+		if record.FetchedAt.IsZero() {
+			t.Errorf("record %s is missing the fetch timestamp", record.Data)
+		}
+		expectedIndex := 0
+		if strings.HasSuffix(record.Data, `-offer"`) {
+			expectedIndex = 1
+		}
+		if record.ElementIndex != expectedIndex {
+			t.Errorf("record %s has element index %d, expected %d", record.Data, record.ElementIndex, expectedIndex)
+		}
+	}
+
+	// Every missing page is reported exactly once
+	failed := results.FailedRequests()
+	if len(failed) != pageCount {
+		t.Fatalf("expected %d failed requests, got %d", pageCount, len(failed))
+	}
+	for _, failure := range failed {
+		if !strings.Contains(failure.OriginalURL, "/missing/") {
+			t.Errorf("unexpected failed request URL %s", failure.OriginalURL)
+		}
+		if failure.StatusCode != http.StatusNotFound {
+			t.Errorf("failed request %s has unexpected status code %d", failure.OriginalURL, failure.StatusCode)
+		}
+		if failure.Category != FAILURE_NOT_FOUND || failure.Attempts != 1 || failure.FailedAt.IsZero() {
+			t.Errorf("failed request %s has unexpected details %+v", failure.OriginalURL, failure)
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeJSONLD(t *testing.T) {
+	server := newTestServer(t)
+	crawler, err := NewCrawler("", ".sku", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.URLs = []string{server.URL + "/product/1", server.URL + "/product/2"}
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	seen := make(map[string]int)
+	for _, record := range results.ScrapedData() {
+		seen[record.Data] = record.ElementIndex
+	}
+	expected := map[string]int{`"1"`: 0, `"1-offer"`: 1, `"2"`: 0, `"2-offer"`: 1}
+	if len(seen) != len(expected) {
+		t.Fatalf("expected %d scraped records, got %v", len(expected), seen)
+	}
+	for data, index := range expected {
+		if got, ok := seen[data]; !ok || got != index {
+			t.Errorf("expected record %s with element index %d, got %v", data, index, seen)
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestResultStoreConcurrentWrites(t *testing.T) {
+	const writers = 50
+	const writes = 200
+
+	store := NewResultStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				_ = store.WriteRecord(ScrapedRecord{Data: fmt.Sprintf("%d-%d", i, j)})
+				_ = store.WriteFailure(FailedRequest{OriginalURL: fmt.Sprintf("https://example.com/%d/%d", i, j)})
+				_ = store.ScrapedData()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(store.ScrapedData()); got != writers*writes {
+		t.Errorf("expected %d scraped records, got %d", writers*writes, got)
+	}
+	if got := len(store.FailedRequests()); got != writers*writes {
+		t.Errorf("expected %d failed requests, got %d", writers*writes, got)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeReportsRejectedURLs(t *testing.T) {
+	server := newTestServer(t)
+	crawler, err := NewCrawler("", "", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.URLs = []string{server.URL + "/product/1", "https://disallowed.example.com/product/2"}
+	crawler.Allowed.Add("127.0.0.1")
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	failed := results.FailedRequests()
+	if len(failed) != 1 {
+		t.Fatalf("expected 1 failed request, got %v", failed)
+	}
+	failure := failed[0]
+	if failure.OriginalURL != "https://disallowed.example.com/product/2" || failure.Category != FAILURE_DISALLOWED || failure.Attempts != 0 {
+		t.Errorf("unexpected failed request %+v", failure)
+	}
+	if crawler.failureSummary[FAILURE_DISALLOWED]["disallowed.example.com"] != 1 {
+		t.Errorf("expected the failure summary to count the rejected URL, got %v", crawler.failureSummary)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeRefusesRedirectToDisallowedDomain(t *testing.T) {
+	server := newTestServer(t)
+	redirect := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/product/1"
+	moved := httptest.NewServer(http.RedirectHandler(redirect, http.StatusFound))
+	t.Cleanup(moved.Close)
+
+	crawler, err := NewCrawler("", ".sku", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.URLs = []string{moved.URL + "/moved"}
+	crawler.Allowed.Add("127.0.0.1")
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+	failed := results.FailedRequests()
+	if len(failed) != 1 || failed[0].Category != FAILURE_DISALLOWED {
+		t.Errorf("expected the redirect to fail as disallowed, got %+v", failed)
+	}
+	if scraped := results.ScrapedData(); len(scraped) != 0 {
+		t.Errorf("expected no scraped records, got %d", len(scraped))
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeReportsRejectedPages(t *testing.T) {
+	pages := map[string]string{
+		"/ok":       `<script type="application/ld+json">{"@type": "Product", "sku": "OK"}</script>`,
+		"/empty":    `<p>No Linked Data</p>`,
+		"/invalid":  `<script type="application/ld+json">{"@type": "Product", "sku": </script>`,
+		"/filtered": `<script type="application/ld+json">{"@type": "Product", "sku": "A"}</script><script type="application/ld+json">{"@type": "Offer"}</script>`,
+		"/error":    `<script type="application/ld+json">{"@type": "Product", "sku": 1}</script>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><head></head><body>%s</body></html>", pages[r.URL.Path])
+	}))
+	t.Cleanup(server.Close)
+
+	crawler, err := NewCrawler("", `select(."@type" == "Product") | .sku | ascii_downcase`, "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	for path := range pages {
+		crawler.URLs = append(crawler.URLs, server.URL+path)
+	}
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	type outcome struct {
+		records  int
+		rejected int
+		reason   string
+	}
+	expected := map[string]outcome{
+		"/empty":    {0, 0, REJECT_NO_MATCH},
+		"/invalid":  {0, 1, REJECT_INVALID_JSON},
+		"/filtered": {1, 1, REJECT_NO_VALUE},
+		"/error":    {0, 1, REJECT_JQ_ERROR},
+	}
+	rejected := results.RejectedPages()
+	if len(rejected) != len(expected) {
+		t.Fatalf("expected %d rejected pages, got %+v", len(expected), rejected)
+	}
+	for _, page := range rejected {
+		path := strings.TrimPrefix(page.OriginalURL, server.URL)
+		actual := outcome{page.Records, page.Rejected, page.Reason}
+		if actual != expected[path] {
+			t.Errorf("page %s: expected %+v, got %+v", path, expected[path], actual)
+		}
+		if page.StatusCode != http.StatusOK {
+			t.Errorf("page %s has unexpected status code %d", path, page.StatusCode)
+		}
+		if (page.Reason == REJECT_INVALID_JSON || page.Reason == REJECT_JQ_ERROR) && page.Error == "" {
+			t.Errorf("page %s is missing the error", path)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns describing the Page of each Scraped Record, written ahead of any Fields
+var csvPageColumns = []string{"url", "final_url", "status_code", "fetched_at", "element_index"}
+
+// Data Sink writing each Scraped Record as a row in a CSV File, either with
+// the Scraped Data and the details of the Page, or with the details of the
+// Page followed by a column per Field, then a column per Input File Column
+// Passed Through
+type CSVDataSink struct {
+	file    *os.File
+	writer  *csv.Writer
+	fields  Fields
+	columns []string
+}
+
+// Error Sink writing each Failed Request as a row in a CSV File
+type CSVErrorSink struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+// Reject Sink writing each Rejected Page as a row in a CSV File
+type CSVRejectSink struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a CSV Data Sink writing to the named File, beginning
+// with a header row of the Page columns, Field names and Column names if any
+// Fields are provided, unless Appending to a File which already has content
+func NewCSVDataSink(name string, delimiter string, fields Fields, columns []string, resume bool) (*CSVDataSink, error) {
+
+	for _, field := range fields {
+		if slices.Contains(csvPageColumns, field.Name) {
+			return nil, fmt.Errorf("[NewCSVDataSink] Field name is Reserved: %s", field.Name)
+		}
+	}
+
+	// Open file ready for writing
+	file, err := openOutputFile(name, resume)
+	if err != nil {
+		return nil, fmt.Errorf("[NewCSVDataSink] %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("[NewCSVDataSink] Stat File Failed: %w", err)
+	}
+
+	// Ready the CSV Writer, which buffers internally
+	w := csv.NewWriter(file)
+	w.Comma = rune(delimiter[0])
+
+	s := &CSVDataSink{file: file, writer: w, fields: fields, columns: columns}
+	if len(fields) > 0 && info.Size() == 0 {
+		header := append([]string(nil), csvPageColumns...)
+		for _, field := range fields {
+			header = append(header, field.Name)
+		}
+		header = append(header, columns...)
+		if err := s.writeRow(header); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("[NewCSVDataSink] Failed Writing the Header: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Write the Scraped Record to the CSV File and Flush it to disk
+func (s *CSVDataSink) WriteRecord(record ScrapedRecord) error {
+
+	// Write the details of the Page followed by the value of each Field when provided,
+	// a Field which fails to select is left empty
+	if len(s.fields) > 0 {
+		values, err := s.fields.Select(record)
+		if err != nil {
+			logger.Error().Err(err).Str("Visited", record.OriginalURL).Msg(doubleIndent)
+		}
+
+		row := []string{
+			record.OriginalURL,
+			record.FinalURL,
+			strconv.Itoa(record.StatusCode),
+			record.FetchedAt.Format(time.RFC3339),
+			strconv.Itoa(record.ElementIndex),
+		}
+		for _, value := range values {
+			if value != nil {
+				row = append(row, *value)
+			} else {
+				row = append(row, "")
+			}
+		}
+		return s.writeRow(append(row, record.Input.Values(s.columns)...))
+	}
+
+	var row []string = make([]string, 8)
+	row[0] = strings.Replace(record.Data, "\n", "", -1)
+	row[1] = record.OriginalURL
+	row[2] = record.FinalURL
+	row[3] = strconv.Itoa(record.StatusCode)
+	row[4] = record.FetchedAt.Format(time.RFC3339)
+	row[5] = strconv.Itoa(record.ElementIndex)
+	row[6] = record.Type
+	row[7] = record.Syntax
+
+	return s.writeRow(append(row, record.Input.Values(s.columns)...))
+}
+
+//---------------------------------------------------------------------------------------
+
+// Write the row to the CSV File and Flush it to disk
+func (s *CSVDataSink) writeRow(row []string) error {
+
+	if err := s.writer.Write(row); err != nil {
+		return fmt.Errorf("[writeRow] Failed Writing to the File: %w", err)
+	}
+
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		return fmt.Errorf("[writeRow] Failed Flushing the File: %w", err)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Flush any buffered rows and Close the CSV File
+func (s *CSVDataSink) Close() error {
+
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("[Close] Failed Flushing the File: %w", err)
+	}
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("[Close] Failed Closing the File: %w", err)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a CSV Error Sink writing to the named File
+func NewCSVErrorSink(name string, delimiter string, resume bool) (*CSVErrorSink, error) {
+
+	// Open file ready for writing
+	file, err := openOutputFile(name, resume)
+	if err != nil {
+		return nil, fmt.Errorf("[NewCSVErrorSink] %w", err)
+	}
+
+	// Ready the CSV Writer, which buffers internally
+	w := csv.NewWriter(file)
+	w.Comma = rune(delimiter[0])
+
+	return &CSVErrorSink{file: file, writer: w}, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Write the Failed Request to the CSV File and Flush it to disk
+func (s *CSVErrorSink) WriteFailure(failure FailedRequest) error {
+
+	var row []string = make([]string, 6)
+	row[0] = strings.Replace(failure.OriginalURL, "\n", "", -1)
+	row[1] = strconv.Itoa(failure.StatusCode)
+	row[2] = failure.Category
+	row[3] = strings.Replace(failure.Error, "\n", " ", -1)
+	row[4] = strconv.Itoa(failure.Attempts)
+	row[5] = failure.FailedAt.Format(time.RFC3339)
+
+	if err := s.writer.Write(row); err != nil {
+		return fmt.Errorf("[WriteFailure] Failed Writing to the File: %w", err)
+	}
+
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		return fmt.Errorf("[WriteFailure] Failed Flushing the File: %w", err)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Flush any buffered rows and Close the CSV File
+func (s *CSVErrorSink) Close() error {
+
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("[Close] Failed Flushing the File: %w", err)
+	}
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("[Close] Failed Closing the File: %w", err)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a CSV Reject Sink writing to the named File
+func NewCSVRejectSink(name string, delimiter string, resume bool) (*CSVRejectSink, error) {
+
+	// Open file ready for writing
+	file, err := openOutputFile(name, resume)
+	if err != nil {
+		return nil, fmt.Errorf("[NewCSVRejectSink] %w", err)
+	}
+
+	// Ready the CSV Writer, which buffers internally
+	w := csv.NewWriter(file)
+	w.Comma = rune(delimiter[0])
+
+	return &CSVRejectSink{file: file, writer: w}, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Write the Rejected Page to the CSV File and Flush it to disk
+func (s *CSVRejectSink) WriteRejected(page RejectedPage) error {
+
+	var row []string = make([]string, 7)
+	row[0] = strings.Replace(page.OriginalURL, "\n", "", -1)
+	row[1] = page.FinalURL
+	row[2] = strconv.Itoa(page.StatusCode)
+	row[3] = strconv.Itoa(page.Records)
+	row[4] = strconv.Itoa(page.Rejected)
+	row[5] = page.Reason
+	row[6] = strings.Replace(page.Error, "\n", " ", -1)
+
+	if err := s.writer.Write(row); err != nil {
+		return fmt.Errorf("[WriteRejected] Failed Writing to the File: %w", err)
+	}
+
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		return fmt.Errorf("[WriteRejected] Failed Flushing the File: %w", err)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Flush any buffered rows and Close the CSV File
+func (s *CSVRejectSink) Close() error {
+
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("[Close] Failed Flushing the File: %w", err)
+	}
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("[Close] Failed Closing the File: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCSVDataSinkFlushesEachRecord(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "results.csv")
+
+	sink, err := NewCSVDataSink(name, ",", nil, nil, false)
+	if err != nil {
+		t.Fatalf("NewCSVDataSink failed: %v", err)
+	}
+
+	record := ScrapedRecord{
+		OriginalURL:  "https://example.com/a",
+		FinalURL:     "https://www.example.com/a",
+		StatusCode:   200,
+		FetchedAt:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		ElementIndex: 1,
+		Type:         "Product",
+		Syntax:       SYNTAX_JSONLD,
+		Data:         `{"name": "A"}`,
+	}
+	if err := sink.WriteRecord(record); err != nil {
+		t.Fatalf("WriteRecord failed: %v", err)
+	}
+
+	// The record must be on disk before the sink is closed
+	expected := `"{""name"": ""A""}",https://example.com/a,https://www.example.com/a,200,2024-01-02T03:04:05Z,1,Product,json-ld` + "\n"
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, string(content))
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
+
+func TestCSVDataSinkRejectsReservedFieldNames(t *testing.T) {
+	fields, err := LoadFieldsFile(writeTestFile(t, "fields.json", `{"name": ".name", "url": "$url"}`), "", nil)
+	if err != nil {
+		t.Fatalf("LoadFieldsFile failed: %v", err)
+	}
+	if _, err := NewCSVDataSink(filepath.Join(t.TempDir(), "results.csv"), ",", fields, nil, false); err == nil {
+		t.Errorf("expected the url field name to be rejected")
+	}
+}
+
+func TestCSVDataSinkWritesFieldColumns(t *testing.T) {
+	fields, err := LoadFieldsFile(writeTestFile(t, "fields.json", `{"name": ".name", "price": ".offers.price", "sku": ".sku", "page": "$url"}`), "", nil)
+	if err != nil {
+		t.Fatalf("LoadFieldsFile failed: %v", err)
+	}
+
+	name := filepath.Join(t.TempDir(), "results.csv")
+	sink, err := NewCSVDataSink(name, ";", fields, nil, false)
+	if err != nil {
+		t.Fatalf("NewCSVDataSink failed: %v", err)
+	}
+
+	fetchedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []ScrapedRecord{
+		{OriginalURL: "https://example.com/a", FinalURL: "https://example.com/a", StatusCode: 200, FetchedAt: fetchedAt, Data: `{"name": "Widget; Deluxe", "offers": {"price": 9.99}, "sku": "W-1"}`},
+		{OriginalURL: "https://example.com/b", FinalURL: "https://example.com/c", StatusCode: 200, FetchedAt: fetchedAt, ElementIndex: 1, Data: `{"name": "Gadget"}`},
+	}
+	for _, record := range records {
+		if err := sink.WriteRecord(record); err != nil {
+			t.Fatalf("WriteRecord failed: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	expected := "url;final_url;status_code;fetched_at;element_index;name;price;sku;page\n" +
+		`https://example.com/a;https://example.com/a;200;2024-01-02T03:04:05Z;0;"Widget; Deluxe";9.99;W-1;https://example.com/a` + "\n" +
+		"https://example.com/b;https://example.com/c;200;2024-01-02T03:04:05Z;1;Gadget;;;https://example.com/b\n"
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, string(content))
+	}
+}
+
+func TestCSVDataSinkAppendSkipsHeader(t *testing.T) {
+	fields, err := LoadFieldsFile(writeTestFile(t, "fields.json", `{"name": ".name"}`), "", nil)
+	if err != nil {
+		t.Fatalf("LoadFieldsFile failed: %v", err)
+	}
+
+	// Each crawl writes a single record, the second Appending to the first
+	name := filepath.Join(t.TempDir(), "results.csv")
+	for i, product := range []string{"Widget", "Gadget"} {
+		sink, err := NewCSVDataSink(name, ",", fields, nil, i > 0)
+		if err != nil {
+			t.Fatalf("NewCSVDataSink failed: %v", err)
+		}
+		record := ScrapedRecord{OriginalURL: "https://example.com/" + product, FinalURL: "https://example.com/" + product, StatusCode: 200, FetchedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Data: `{"name": "` + product + `"}`}
+		if err := sink.WriteRecord(record); err != nil {
+			t.Fatalf("WriteRecord failed: %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	expected := "url,final_url,status_code,fetched_at,element_index,name\n" +
+		"https://example.com/Widget,https://example.com/Widget,200,2024-01-02T03:04:05Z,0,Widget\n" +
+		"https://example.com/Gadget,https://example.com/Gadget,200,2024-01-02T03:04:05Z,0,Gadget\n"
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, string(content))
+	}
+}
+
+func TestCSVDataSinkWritesInputColumns(t *testing.T) {
+	fields, err := LoadFieldsFile(writeTestFile(t, "fields.json", `{"name": ".name"}`), "", nil)
+	if err != nil {
+		t.Fatalf("LoadFieldsFile failed: %v", err)
+	}
+
+	// A Record without Input Columns, such as one from a Followed Link, leaves them empty
+	name := filepath.Join(t.TempDir(), "results.csv")
+	sink, err := NewCSVDataSink(name, ",", fields, []string{"sku", "category"}, false)
+	if err != nil {
+		t.Fatalf("NewCSVDataSink failed: %v", err)
+	}
+	fetchedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []ScrapedRecord{
+		{OriginalURL: "https://example.com/a", FinalURL: "https://example.com/a", StatusCode: 200, FetchedAt: fetchedAt, Data: `{"name": "Widget"}`, Input: InputColumns{{Name: "category", Value: "tools"}, {Name: "sku", Value: "W-1"}}},
+		{OriginalURL: "https://example.com/b", FinalURL: "https://example.com/b", StatusCode: 200, FetchedAt: fetchedAt, Data: `{"name": "Gadget"}`},
+	}
+	for _, record := range records {
+		if err := sink.WriteRecord(record); err != nil {
+			t.Fatalf("WriteRecord failed: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	expected := "url,final_url,status_code,fetched_at,element_index,name,sku,category\n" +
+		"https://example.com/a,https://example.com/a,200,2024-01-02T03:04:05Z,0,Widget,W-1,tools\n" +
+		"https://example.com/b,https://example.com/b,200,2024-01-02T03:04:05Z,0,Gadget,,\n"
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, string(content))
+	}
+}
+
+func TestCSVErrorSinkWritesFailureDetails(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "failed.csv")
+
+	sink, err := NewCSVErrorSink(name, ",", false)
+	if err != nil {
+		t.Fatalf("NewCSVErrorSink failed: %v", err)
+	}
+	failure := FailedRequest{
+		OriginalURL: "https://example.com/a",
+		StatusCode:  0,
+		Category:    FAILURE_TIMEOUT,
+		Error:       "Get \"https://example.com/a\": context deadline exceeded\n(Client.Timeout exceeded)",
+		Attempts:    3,
+		FailedAt:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := sink.WriteFailure(failure); err != nil {
+		t.Fatalf("WriteFailure failed: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	expected := `https://example.com/a,0,timeout,"Get ""https://example.com/a"": context deadline exceeded (Client.Timeout exceeded)",3,2024-01-02T03:04:05Z` + "\n"
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, string(content))
+	}
+}
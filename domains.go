@@ -0,0 +1,126 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gocolly/colly"
+	"github.com/weppos/publicsuffix-go/publicsuffix"
+)
+
+// Set of the Domains the Crawler is Allowed to Visit, safe for concurrent use
+// so Domains can be Added while URLs are Streamed. An empty set Allows every Domain.
+type DomainSet struct {
+	lock    sync.RWMutex
+	domains map[string]bool
+}
+
+// HTTP Transport refusing every Request to a Domain which is not Allowed,
+// including each Redirect
+type domainTransport struct {
+	http.RoundTripper
+	allowed *DomainSet
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of an empty Domain Set
+func NewDomainSet() *DomainSet {
+	return &DomainSet{domains: make(map[string]bool)}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Add the Domain to the set, returning false if it was already Allowed
+func (s *DomainSet) Add(domain string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.domains[domain] {
+		return false
+	}
+	s.domains[domain] = true
+
+	return true
+}
+
+//---------------------------------------------------------------------------------------
+
+// Add both the registered Domain name and the hostname of the URL to the set
+func (s *DomainSet) AddURL(rawURL string) error {
+
+	// Parse URL and retrieve the hostname
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("[AddURL] URL Parse Failed: %w", err)
+	}
+	hostname := u.Hostname()
+
+	// Parse the domain name from the hostname
+	domain, err := publicsuffix.Domain(hostname)
+	if err != nil {
+		return fmt.Errorf("[AddURL] Domain Parse Failed: %w", err)
+	}
+
+	// Add domain name, e.g. google.com, then hostname, e.g. www.google.com
+	for _, name := range []string{domain, hostname} {
+		if s.Add(name) {
+			logger.Info().Str("allowed", name).Msg(doubleIndent)
+		}
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return whether the hostname is Allowed
+func (s *DomainSet) Allowed(hostname string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.domains) == 0 || s.domains[hostname]
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return an error wrapping colly.ErrForbiddenDomain unless the URL is of an Allowed Domain
+func (s *DomainSet) check(rawURL string) error {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("[check] URL Parse Failed: %w", err)
+	}
+	if !s.Allowed(u.Hostname()) {
+		return fmt.Errorf("%w: %s", colly.ErrForbiddenDomain, u.Hostname())
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Make the Request unless the Domain is not Allowed
+func (t *domainTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.allowed.Allowed(req.URL.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", colly.ErrForbiddenDomain, req.URL.Hostname())
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
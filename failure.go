@@ -0,0 +1,203 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// Categories of Failed Requests, reported in the Failure File and Summary
+const FAILURE_DISALLOWED = "disallowed"
+const FAILURE_ROBOTS = "robots"
+const FAILURE_INVALID_URL = "invalid_url"
+const FAILURE_DNS = "dns"
+const FAILURE_TIMEOUT = "timeout"
+const FAILURE_TLS = "tls"
+const FAILURE_CONNECTION = "connection"
+const FAILURE_NOT_FOUND = "not_found"
+const FAILURE_RATE_LIMITED = "rate_limited"
+const FAILURE_CLIENT_ERROR = "client_error"
+const FAILURE_SERVER_ERROR = "server_error"
+const FAILURE_OTHER = "other"
+
+// Count of the Failed Requests by Category and then by Domain
+type FailureSummary map[string]map[string]int
+
+//---------------------------------------------------------------------------------------
+
+// Return a new Failed Request for the Original URL, classifying the error
+func newFailedRequest(originalURL string, statusCode int, err error, attempts int) FailedRequest {
+
+	return FailedRequest{
+		OriginalURL: originalURL,
+		StatusCode:  statusCode,
+		Category:    classifyFailure(statusCode, err),
+		Error:       err.Error(),
+		Attempts:    attempts,
+		FailedAt:    time.Now().UTC(),
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the HTTP status code of a Failed Request, or when no response was received
+// as the robots.txt File of the Host returned a Server Error, its status code
+func failureStatusCode(statusCode int, err error) int {
+
+	var robotsErr *RobotsStatusError
+	if statusCode == 0 && errors.As(err, &robotsErr) {
+		return robotsErr.StatusCode
+	}
+
+	return statusCode
+}
+
+//---------------------------------------------------------------------------------------
+
+// Classify the cause of a Failed Request, the HTTP status code takes
+// precedence as the error of an HTTP error response is only its status text
+func classifyFailure(statusCode int, err error) string {
+
+	statusCode = failureStatusCode(statusCode, err)
+	switch {
+	case statusCode == http.StatusNotFound || statusCode == http.StatusGone:
+		return FAILURE_NOT_FOUND
+	case statusCode == http.StatusTooManyRequests:
+		return FAILURE_RATE_LIMITED
+	case statusCode >= 500:
+		return FAILURE_SERVER_ERROR
+	case statusCode >= 400:
+		return FAILURE_CLIENT_ERROR
+	}
+
+	// Requests rejected by the Collector before they were made
+	switch {
+	case errors.Is(err, ErrRobotsDisallowed), errors.Is(err, colly.ErrRobotsTxtBlocked):
+		return FAILURE_ROBOTS
+	case errors.Is(err, colly.ErrForbiddenDomain), errors.Is(err, colly.ErrForbiddenURL),
+		errors.Is(err, colly.ErrNoURLFiltersMatch), errors.Is(err, colly.ErrAlreadyVisited),
+		errors.Is(err, colly.ErrMaxDepth):
+		return FAILURE_DISALLOWED
+	case errors.Is(err, colly.ErrMissingURL):
+		return FAILURE_INVALID_URL
+	}
+
+	// Network errors, the order matters as a DNS error may also be a timeout
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var urlErr *url.Error
+	var recordHeaderErr tls.RecordHeaderError
+	var certificateErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certificateInvalidErr x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &dnsErr):
+		return FAILURE_DNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FAILURE_TIMEOUT
+	case errors.As(err, &recordHeaderErr), errors.As(err, &certificateErr), errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &certificateInvalidErr), strings.Contains(err.Error(), "tls: "):
+		return FAILURE_TLS
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return FAILURE_CONNECTION
+	case errors.As(err, &urlErr) && urlErr.Op == "parse":
+		return FAILURE_INVALID_URL
+	}
+
+	// Any other error from dialing or reading the connection
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return FAILURE_CONNECTION
+	}
+
+	return FAILURE_OTHER
+}
+
+//---------------------------------------------------------------------------------------
+
+// Count the Failed Request against its Category and the hostname of its Original URL
+func (s FailureSummary) Add(failure FailedRequest) {
+
+	domain := failure.OriginalURL
+	if u, err := url.Parse(failure.OriginalURL); err == nil && u.Hostname() != "" {
+		domain = u.Hostname()
+	}
+
+	if s[failure.Category] == nil {
+		s[failure.Category] = make(map[string]int)
+	}
+	s[failure.Category][domain]++
+}
+
+//---------------------------------------------------------------------------------------
+
+// Log the Failed Request counts by Category, most frequent first, each followed by its Domains
+func (s FailureSummary) Log() {
+
+	if len(s) == 0 {
+		return
+	}
+
+	type count struct {
+		name  string
+		total int
+	}
+	sortCounts := func(counts []count) {
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].total != counts[j].total {
+				return counts[i].total > counts[j].total
+			}
+			return counts[i].name < counts[j].name
+		})
+	}
+
+	var categories []count
+	for category, domains := range s {
+		total := 0
+		for _, n := range domains {
+			total += n
+		}
+		categories = append(categories, count{category, total})
+	}
+	sortCounts(categories)
+
+	logger.Info().Msgf("%s Failed Request Summary", indent)
+	for _, category := range categories {
+		logger.Info().Str("Category", category.name).Int("Failures", category.total).Msg(doubleIndent)
+
+		var domains []count
+		for domain, n := range s[category.name] {
+			domains = append(domains, count{domain, n})
+		}
+		sortCounts(domains)
+		for _, domain := range domains {
+			logger.Info().Str("Category", category.name).Str("Domain", domain.name).Int("Failures", domain.total).Msg(doubleIndent)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/gocolly/colly"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		err        error
+		expected   string
+	}{
+		{"not found", 404, errors.New("Not Found"), FAILURE_NOT_FOUND},
+		{"gone", 410, errors.New("Gone"), FAILURE_NOT_FOUND},
+		{"rate limited", 429, errors.New("Too Many Requests"), FAILURE_RATE_LIMITED},
+		{"forbidden", 403, errors.New("Forbidden"), FAILURE_CLIENT_ERROR},
+		{"server error", 503, errors.New("Service Unavailable"), FAILURE_SERVER_ERROR},
+		{"disallowed domain", 0, colly.ErrForbiddenDomain, FAILURE_DISALLOWED},
+		{"robots", 0, colly.ErrRobotsTxtBlocked, FAILURE_ROBOTS},
+		{"robots disallowed", 0, ErrRobotsDisallowed, FAILURE_ROBOTS},
+		{"robots server error", 0, &RobotsStatusError{StatusCode: 503}, FAILURE_SERVER_ERROR},
+		{"missing url", 0, colly.ErrMissingURL, FAILURE_INVALID_URL},
+		{"invalid url", 0, &url.Error{Op: "parse", URL: "::", Err: errors.New("missing protocol scheme")}, FAILURE_INVALID_URL},
+		{"dns", 0, &url.Error{Op: "Get", URL: "https://nowhere.invalid", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}}, FAILURE_DNS},
+		{"timeout", 0, &url.Error{Op: "Get", URL: "https://example.com", Err: context.DeadlineExceeded}, FAILURE_TIMEOUT},
+		{"dial timeout", 0, &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, FAILURE_TIMEOUT},
+		{"tls", 0, &url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, FAILURE_TLS},
+		{"tls handshake", 0, fmt.Errorf("remote error: tls: handshake failure"), FAILURE_TLS},
+		{"refused", 0, &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, FAILURE_CONNECTION},
+		{"other", 0, errors.New("unexpected"), FAILURE_OTHER},
+	}
+
+	for _, test := range tests {
+		if actual := classifyFailure(test.statusCode, test.err); actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestFailureSummaryAdd(t *testing.T) {
+	summary := make(FailureSummary)
+	summary.Add(FailedRequest{OriginalURL: "https://www.example.com/a", Category: FAILURE_NOT_FOUND})
+	summary.Add(FailedRequest{OriginalURL: "https://www.example.com/b", Category: FAILURE_NOT_FOUND})
+	summary.Add(FailedRequest{OriginalURL: "https://example.org/c", Category: FAILURE_TIMEOUT})
+	summary.Add(FailedRequest{OriginalURL: "not a url", Category: FAILURE_INVALID_URL})
+
+	expected := FailureSummary{
+		FAILURE_NOT_FOUND:   {"www.example.com": 2},
+		FAILURE_TIMEOUT:     {"example.org": 1},
+		FAILURE_INVALID_URL: {"not a url": 1},
+	}
+	if fmt.Sprint(summary) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, summary)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Named Field selected from the Scraped Data by a jq path, e.g. .offers.price
+type Field struct {
+	Name       string
+	Expression string
+	jq         *JQSelector
+}
+
+// List of Named Fields, in the order the columns are written
+type Fields []Field
+
+//---------------------------------------------------------------------------------------
+
+// Load the Fields from a JSON File holding an object of column name to jq
+// expression, keeping the order the names appear in the File. Each jq
+// expression is Compiled once with the jq Function Definitions and Variables.
+func LoadFieldsFile(name string, definitions string, args JQArgs) (Fields, error) {
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("[LoadFieldsFile] Read File Failed: %w", err)
+	}
+
+	// Decode the object token by token, as decoding into a map loses the order
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("[LoadFieldsFile] File must contain a JSON Object of name to jq expression")
+	}
+
+	var fields Fields
+	seen := make(map[string]bool)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("[LoadFieldsFile] JSON Decode Failed: %w", err)
+		}
+		name := token.(string)
+
+		var expression string
+		if err := decoder.Decode(&expression); err != nil {
+			return nil, fmt.Errorf("[LoadFieldsFile] jq expression for %s must be a string: %w", name, err)
+		}
+		if name == "" || expression == "" {
+			return nil, fmt.Errorf("[LoadFieldsFile] Field name and jq expression must not be empty")
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("[LoadFieldsFile] Duplicate Field name: %s", name)
+		}
+		seen[name] = true
+
+		jq, err := NewJQSelector(expression, definitions, args)
+		if err != nil {
+			return nil, fmt.Errorf("[LoadFieldsFile] Invalid jq expression for %s: %w", name, err)
+		}
+		fields = append(fields, Field{Name: name, Expression: expression, jq: jq})
+	}
+
+	return fields, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the value of each Field selected from the JSON Data of the Scraped
+// Record, nil where the Data is not JSON or the jq path selects nothing or null.
+// Strings are returned unquoted, any other value is returned as raw JSON.
+func (f Fields) Select(record ScrapedRecord) ([]*string, error) {
+
+	values := make([]*string, len(f))
+	if len(f) == 0 {
+		return values, nil
+	}
+
+	var data any
+	if err := json.Unmarshal([]byte(record.Data), &data); err != nil {
+		return values, nil
+	}
+
+	var errs []error
+	for i, field := range f {
+		selected, err := field.jq.SelectValue(data, record.OriginalURL, JQ_RESULTS_FIRST)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Field %s: %w", field.Name, err))
+		}
+		if len(selected) == 0 || selected[0] == "null" {
+			continue
+		}
+
+		value := selected[0]
+		var text string
+		if json.Unmarshal([]byte(value), &text) == nil {
+			value = text
+		}
+		values[i] = &value
+	}
+
+	return values, errors.Join(errs...)
+}
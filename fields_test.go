@@ -0,0 +1,101 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write the content to a File within a temporary directory, returning its name
+func writeTestFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	name = filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return name
+}
+
+func TestLoadFieldsFileKeepsOrder(t *testing.T) {
+	name := writeTestFile(t, "fields.json", `{"sku": ".sku", "price": "first(.offers[].price)", "brand": "brand_name"}`)
+
+	fields, err := LoadFieldsFile(name, `def brand_name: .brand.name;`, nil)
+	if err != nil {
+		t.Fatalf("LoadFieldsFile failed: %v", err)
+	}
+
+	expected := []string{"sku", "price", "brand"}
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d fields, got %d", len(expected), len(fields))
+	}
+	for i, field := range fields {
+		if field.Name != expected[i] {
+			t.Errorf("expected field %d to be %s, got %s", i, expected[i], field.Name)
+		}
+	}
+}
+
+func TestLoadFieldsFileInvalid(t *testing.T) {
+	tests := map[string]string{
+		"not an object":      `[".sku"]`,
+		"not a string":       `{"sku": 1}`,
+		"duplicate name":     `{"sku": ".sku", "sku": ".id"}`,
+		"invalid expression": `{"sku": ".sku |"}`,
+	}
+	for name, content := range tests {
+		if _, err := LoadFieldsFile(writeTestFile(t, "fields.json", content), "", nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestFieldsSelect(t *testing.T) {
+	name := writeTestFile(t, "fields.json", `{"sku": ".sku", "price": ".offers.price", "offers": ".offers", "missing": ".missing", "page": "$url"}`)
+	fields, err := LoadFieldsFile(name, "", nil)
+	if err != nil {
+		t.Fatalf("LoadFieldsFile failed: %v", err)
+	}
+
+	values, err := fields.Select(ScrapedRecord{
+		OriginalURL: "https://example.com/a",
+		Data:        `{"sku": "A-1", "offers": {"price": 9.5}}`,
+	})
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	expected := []string{"A-1", "9.5", `{"price":9.5}`, "", "https://example.com/a"}
+	for i, value := range values {
+		actual := ""
+		if value != nil {
+			actual = *value
+		}
+		if actual != expected[i] {
+			t.Errorf("field %s: expected %q, got %q", fields[i].Name, expected[i], actual)
+		}
+	}
+	if values[3] != nil {
+		t.Errorf("expected a missing field to be nil")
+	}
+
+	// Data which is not JSON selects nothing
+	values, err = fields.Select(ScrapedRecord{Data: "plain text"})
+	if err != nil || values[0] != nil {
+		t.Errorf("expected no values for plain text, got %v, %v", values, err)
+	}
+}
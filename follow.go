@@ -0,0 +1,108 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+	"regexp"
+
+	"github.com/gocolly/colly"
+)
+
+// Depth of a Page from the URL List it was Discovered from, held in the Request Context
+const DEPTH = "DEPTH"
+
+// Scope of the Links Followed from each Page, no Links are Followed unless
+// MaxDepth is set. Include and Exclude are optional.
+type FollowPolicy struct {
+	MaxDepth int
+	Include  *regexp.Regexp
+	Exclude  *regexp.Regexp
+}
+
+//---------------------------------------------------------------------------------------
+
+// Queue a Visit to the Link unless it is beyond the Maximum Depth, out of scope or
+// already Visited, so Links between Pages never cause a loop
+func (c *Crawler) followLink(element *colly.HTMLElement) {
+
+	depth, _ := element.Request.Ctx.GetAny(DEPTH).(int)
+	if depth >= c.Follow.MaxDepth || c.Stopped() {
+		return
+	}
+
+	link, ok := c.Follow.scope(element.Request.AbsoluteURL(element.Attr("href")), c.Allowed)
+	if !ok || !c.markVisited(link, nil) {
+		return
+	}
+	logger.Debug().Int("Depth", depth+1).Str("Link", link).Str("Visited", element.Request.Ctx.Get(ORIGINAL_URL)).Msg(doubleIndent)
+
+	// Each Link is a new Page, so is given its own Request Context
+	ctx := colly.NewContext()
+	ctx.Put(ORIGINAL_URL, link)
+	ctx.Put(DEPTH, depth+1)
+	if err := c.Collector.Request("GET", link, nil, ctx, nil); err != nil {
+		c.writeFailure(newFailedRequest(link, 0, err, 0))
+		logger.Error().Err(err).Str("Visited", link).Msg(doubleIndent)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Link without its fragment if it is an http or https URL of an Allowed
+// Domain, Matching Include and not Exclude when provided, otherwise false
+func (p FollowPolicy) scope(link string, allowed *DomainSet) (string, bool) {
+
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	link = u.String()
+
+	if !allowed.Allowed(u.Hostname()) {
+
+		return "", false
+	}
+	if p.Include != nil && !p.Include.MatchString(link) {
+		return "", false
+	}
+	if p.Exclude != nil && p.Exclude.MatchString(link) {
+		return "", false
+	}
+
+	return link, true
+}
+
+//---------------------------------------------------------------------------------------
+
+// Mark the Link, or Streamed URL along with its Pass Through Columns, as Visited
+// for the rest of the crawl, returning false if it already was
+func (c *Crawler) markVisited(link string, columns InputColumns) bool {
+	c.followLock.Lock()
+	defer c.followLock.Unlock()
+
+	if c.visited[link] {
+		return false
+	}
+	c.visited[link] = true
+	c.discovered = append(c.discovered, link)
+	if columns != nil {
+		c.inputs[link] = columns
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Start a local HTTP Server of linked Pages, each with a JSON-LD script block
+// naming the Page, along with Links off site, to fragments and back to itself
+func newLinkedTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	links := map[string][]string{
+		"/":  {"/a", "/b#reviews", "mailto:shop@example.com", "http://localhost/elsewhere"},
+		"/a": {"/", "/a", "c"},
+		"/b": {"/a#top"},
+		"/c": {"/d"},
+		"/d": {},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pageLinks, ok := links[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<html><head><script type="application/ld+json">{"@type": "WebPage", "name": "%s"}</script></head><body>`, r.URL.Path)
+		for _, link := range pageLinks {
+			fmt.Fprintf(w, `<a href="%s">link</a>`, link)
+		}
+		fmt.Fprint(w, `</body></html>`)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeFollowLinks(t *testing.T) {
+	server := newLinkedTestServer(t)
+
+	tests := []struct {
+		name     string
+		policy   FollowPolicy
+		expected []string
+	}{
+		{"not following", FollowPolicy{}, []string{"/"}},
+		{"depth 1", FollowPolicy{MaxDepth: 1}, []string{"/", "/a", "/b"}},
+		{"depth 2", FollowPolicy{MaxDepth: 2}, []string{"/", "/a", "/b", "/c"}},
+		{"exclude", FollowPolicy{MaxDepth: 3, Exclude: regexp.MustCompile(`/b$`)}, []string{"/", "/a", "/c", "/d"}},
+		{"include", FollowPolicy{MaxDepth: 3, Include: regexp.MustCompile(`/[ab]$`)}, []string{"/", "/a", "/b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crawler, err := NewCrawler("", ".name", "", nil, 0, 10)
+			if err != nil {
+				t.Fatalf("NewCrawler failed: %v", err)
+			}
+			crawler.ExtractJSONLD = true
+			crawler.Follow = tt.policy
+			crawler.URLs = []string{server.URL + "/"}
+			crawler.Allowed.Add("127.0.0.1")
+
+			results := NewResultStore()
+			if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+				t.Fatalf("ExecuteScrape failed: %v", err)
+			}
+
+			// Every Page is Scraped once, with no Failures for the Links out of scope
+			var scraped []string
+			for _, record := range results.ScrapedData() {
+				scraped = append(scraped, strings.Trim(record.Data, `"`))
+				if record.OriginalURL != server.URL+strings.Trim(record.Data, `"`) {
+					t.Errorf("record %s has unexpected original URL %s", record.Data, record.OriginalURL)
+				}
+			}
+			sort.Strings(scraped)
+			if strings.Join(scraped, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v, got %v", tt.expected, scraped)
+			}
+			if failed := results.FailedRequests(); len(failed) != 0 {
+				t.Errorf("expected no failed requests, got %+v", failed)
+			}
+		})
+	}
+}
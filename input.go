@@ -0,0 +1,498 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Formats of the Input File containing URLs to Scrape
+const INPUT_CSV = "csv"
+const INPUT_TEXT = "text"
+const INPUT_JSONL = "jsonl"
+
+// Default field of each JSON Lines object holding the URL
+const DEFAULT_URL_FIELD = "url"
+
+// Longest line accepted from a text or JSON Lines Input File
+const MAX_INPUT_LINE = 16 * 1024 * 1024
+
+// Reader of the URLs to Scrape, returning io.EOF once every URL has been Read.
+// Columns returns the names of the Pass Through Columns of each URL, if any, and
+// Layout where the URL and those Columns are found in each row.
+type URLReader interface {
+	Read() (InputURL, error)
+	Columns() []string
+	Layout() InputLayout
+	Close() error
+}
+
+// Options of the URL Readers, each only applies to the Formats supporting it
+type InputOptions struct {
+	Format      string
+	Delimiter   string
+	URLField    string
+	URLColumn   string
+	Header      bool
+	PassThrough bool
+}
+
+// URL Read from the Input File, along with the Columns Passed Through to the
+// Output alongside each Record Scraped from it
+type InputURL struct {
+	URL     string
+	Columns InputColumns
+}
+
+// Column of the Input File Passed Through to the Output
+type InputColumn struct {
+	Name  string
+	Value string
+}
+
+// Columns of the Input File Passed Through to the Output, in Input File order
+type InputColumns []InputColumn
+
+// Layout of the rows of a CSV Input File, the Header Row if there is one, the
+// 0-based index of the URL Column, and that of each Pass Through Column, so the
+// URLs can be written back in the same Layout. Other Formats have a single column.
+type InputLayout struct {
+	Header  []string
+	Column  int
+	Indexes []int
+}
+
+// URL Reader returning the URL column of each row of a CSV File, by default the
+// first, along with the other columns when Passing them Through
+type csvURLReader struct {
+	closer  io.Closer
+	reader  *csv.Reader
+	header  []string
+	column  int
+	names   []string
+	indexes []int
+	next    []string
+}
+
+// URL Reader returning each line of a text File, skipping blank lines and # comments
+type textURLReader struct {
+	closer  io.Closer
+	scanner *bufio.Scanner
+}
+
+// URL Reader returning the URL Field of each object of a JSON Lines File
+type jsonlURLReader struct {
+	closer  io.Closer
+	scanner *bufio.Scanner
+	field   []string
+	line    int
+}
+
+//---------------------------------------------------------------------------------------
+
+// Open the named Input File, or stdin when named "-", returning the URL Reader of its
+// Format. A gzip or zstd compressed File is decompressed, and when no Format is provided
+// it is taken from the File extension, otherwise CSV.
+func OpenURLReader(name string, options InputOptions) (URLReader, error) {
+
+	var file io.ReadCloser = io.NopCloser(os.Stdin)
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("[OpenURLReader] Open File Failed: %w", err)
+		}
+		file = f
+	}
+
+	input, closer, err := decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("[OpenURLReader] %w", err)
+	}
+
+	format := options.Format
+	if format == "" {
+		format = inputFormat(name)
+	}
+
+	switch format {
+	case INPUT_CSV:
+		reader, err := newCSVURLReader(input, closer, options)
+		if err != nil {
+			closer.Close()
+			return nil, fmt.Errorf("[OpenURLReader] %w", err)
+		}
+		return reader, nil
+	case INPUT_TEXT:
+		return &textURLReader{closer: closer, scanner: newLineScanner(input)}, nil
+	case INPUT_JSONL:
+		field := options.URLField
+		if field == "" {
+			field = DEFAULT_URL_FIELD
+		}
+		return &jsonlURLReader{closer: closer, scanner: newLineScanner(input), field: strings.Split(field, ".")}, nil
+	}
+
+	closer.Close()
+	return nil, fmt.Errorf("[OpenURLReader] Unknown Input Format: %s", format)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return a CSV URL Reader, reading the Header Row if there is one so the URL Column
+// can be found by name. The Pass Through Columns are named by the Header Row,
+// otherwise as column_N by their 1-based index in the first row.
+func newCSVURLReader(input io.Reader, closer io.Closer, options InputOptions) (*csvURLReader, error) {
+
+	// Skip any UTF-8 Byte Order Mark at the start of the File, so it is not read as part of the first column
+	buffered := bufio.NewReader(input)
+	if bom, _ := buffered.Peek(3); bytes.Equal(bom, []byte("\ufeff")) {
+		buffered.Discard(3)
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.Comma = rune(options.Delimiter[0])
+	reader.FieldsPerRecord = -1
+	r := &csvURLReader{closer: closer, reader: reader}
+
+	// The URL Column is given by its 1-based index, or by name when there is a Header Row
+	header, byName := options.Header, false
+	if options.URLColumn != "" {
+		index, err := strconv.Atoi(options.URLColumn)
+		switch {
+		case err != nil:
+			header, byName = true, true
+		case index < 1:
+			return nil, fmt.Errorf("URL Column index must be 1 or more: %s", options.URLColumn)
+		default:
+			r.column = index - 1
+		}
+	}
+
+	// Read the Header Row, or the first row so the Pass Through Columns can be named up front
+	first, err := reader.Read()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("CSV Reader Failed: %w", err)
+	}
+
+	// The Header Row is matched ignoring the spaces surrounding each name, which must
+	// be unique when naming the URL Column or the Pass Through Columns
+	if header && (byName || options.PassThrough) {
+		seen := make(map[string]bool)
+		for _, name := range first {
+			name = strings.TrimSpace(name)
+			if seen[name] {
+				return nil, fmt.Errorf("Duplicate Column Name in the Header Row: %s", name)
+			}
+			seen[name] = true
+		}
+	}
+	if byName {
+		name := strings.TrimSpace(options.URLColumn)
+		if r.column = slices.IndexFunc(first, func(s string) bool { return strings.TrimSpace(s) == name }); r.column < 0 {
+			return nil, fmt.Errorf("URL Column not found in the Header Row: %s", options.URLColumn)
+		}
+	}
+	if header {
+		r.header = first
+	} else {
+		r.next = first
+	}
+	if !options.PassThrough {
+		return r, nil
+	}
+
+	for i := range first {
+		if i == r.column {
+			continue
+		}
+		name := fmt.Sprintf("column_%d", i+1)
+		if header {
+			name = strings.TrimSpace(first[i])
+		}
+		r.names = append(r.names, name)
+		r.indexes = append(r.indexes, i)
+	}
+
+	return r, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the row of the URL in the Layout, with each Pass Through Column at its
+// index and every other column left empty
+func (l InputLayout) row(url string, columns InputColumns) []string {
+
+	width := max(len(l.Header), l.Column+1)
+	for _, index := range l.Indexes {
+		width = max(width, index+1)
+	}
+
+	row := make([]string, width)
+	row[l.Column] = url
+	for i, column := range columns {
+		if i < len(l.Indexes) {
+			row[l.Indexes[i]] = column.Value
+		}
+	}
+
+	return row
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Input Format from the File extension, ignoring any compression extension
+func inputFormat(name string) string {
+
+	name = strings.ToLower(name)
+	for _, ext := range []string{".gz", ".zst", ".zstd"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	switch filepath.Ext(name) {
+	case ".txt", ".text":
+		return INPUT_TEXT
+	case ".jsonl", ".ndjson":
+		return INPUT_JSONL
+	}
+
+	return INPUT_CSV
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return a Reader decompressing the File if it begins with the gzip or zstd magic
+// number, along with the Closer of both the Reader and the File
+func decompress(file io.ReadCloser) (io.Reader, io.Closer, error) {
+
+	buffered := bufio.NewReader(file)
+	magic, err := buffered.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("Read File Failed: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gzip Reader Failed: %w", err)
+		}
+		return gz, closers{gz, file}, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("zstd Reader Failed: %w", err)
+		}
+		return zr, closers{zr.IOReadCloser(), file}, nil
+	}
+
+	return buffered, file, nil
+}
+
+// Closers Closed in order, returning the first error
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var errs []error
+	for _, closer := range c {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return a Scanner of the lines of the Reader, accepting lines up to MAX_INPUT_LINE
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MAX_INPUT_LINE)
+	return scanner
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the URL column of the next row which has a value, along with the
+// Pass Through Columns, any missing from a short row being left empty
+func (r *csvURLReader) Read() (InputURL, error) {
+	for {
+		row := r.next
+		r.next = nil
+		if row == nil {
+			var err error
+			row, err = r.reader.Read()
+			if err == io.EOF {
+				return InputURL{}, io.EOF
+			}
+			if err != nil {
+				return InputURL{}, fmt.Errorf("[Read] CSV Reader Failed: %w", err)
+			}
+		}
+		if r.column >= len(row) || row[r.column] == "" {
+			continue
+		}
+
+		input := InputURL{URL: row[r.column]}
+		for i, index := range r.indexes {
+			column := InputColumn{Name: r.names[i]}
+			if index < len(row) {
+				column.Value = row[index]
+			}
+			input.Columns = append(input.Columns, column)
+		}
+		return input, nil
+	}
+}
+
+// Return the names of the Pass Through Columns
+func (r *csvURLReader) Columns() []string {
+	return r.names
+}
+
+// Return the Header Row, if any, along with the index of the URL and Pass Through Columns
+func (r *csvURLReader) Layout() InputLayout {
+	return InputLayout{Header: r.header, Column: r.column, Indexes: r.indexes}
+}
+
+func (r *csvURLReader) Close() error {
+	return r.closer.Close()
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the next line which is neither blank nor a # comment
+func (r *textURLReader) Read() (InputURL, error) {
+	for r.scanner.Scan() {
+		line := strings.TrimSpace(r.scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return InputURL{URL: line}, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return InputURL{}, fmt.Errorf("[Read] Text Reader Failed: %w", err)
+	}
+	return InputURL{}, io.EOF
+}
+
+// Text Files have no Pass Through Columns
+func (r *textURLReader) Columns() []string {
+	return nil
+}
+
+// Text Files are written back as a single column
+func (r *textURLReader) Layout() InputLayout {
+	return InputLayout{}
+}
+
+func (r *textURLReader) Close() error {
+	return r.closer.Close()
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the URL Field of the next JSON object which has one, the Field may be
+// a dot separated path into nested objects
+func (r *jsonlURLReader) Read() (InputURL, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var value any
+		if err := json.Unmarshal(line, &value); err != nil {
+			return InputURL{}, fmt.Errorf("[Read] Line %d is not valid JSON: %w", r.line, err)
+		}
+		for _, name := range r.field {
+			object, _ := value.(map[string]any)
+			value = object[name]
+		}
+
+		url, ok := value.(string)
+		if !ok || url == "" {
+			logger.Warn().Int("Line", r.line).Str("Field", strings.Join(r.field, ".")).Msgf("%s JSON Line has no URL", doubleIndent)
+			continue
+		}
+		return InputURL{URL: url}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return InputURL{}, fmt.Errorf("[Read] JSON Lines Reader Failed: %w", err)
+	}
+	return InputURL{}, io.EOF
+}
+
+// JSON Lines Files have no Pass Through Columns
+func (r *jsonlURLReader) Columns() []string {
+	return nil
+}
+
+// JSON Lines Files are written back as a single column
+func (r *jsonlURLReader) Layout() InputLayout {
+	return InputLayout{}
+}
+
+func (r *jsonlURLReader) Close() error {
+	return r.closer.Close()
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the value of each named Column, or an empty string for a Column not Passed Through
+func (c InputColumns) Values(names []string) []string {
+	values := make([]string, len(names))
+	for i, name := range names {
+		for _, column := range c {
+			if column.Name == name {
+				values[i] = column.Value
+				break
+			}
+		}
+	}
+	return values
+}
+
+//---------------------------------------------------------------------------------------
+
+// Marshal the Columns as a JSON Object, keeping the Input File order
+func (c InputColumns) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range c {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(column.Name)
+		value, _ := json.Marshal(column.Value)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,240 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Read every URL from the Input File, failing the test on any error
+func readTestURLs(t *testing.T, name string, options InputOptions) []InputURL {
+	t.Helper()
+
+	reader, err := OpenURLReader(name, options)
+	if err != nil {
+		t.Fatalf("OpenURLReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	var inputs []InputURL
+	for {
+		input, err := reader.Read()
+		if err == io.EOF {
+			return inputs
+		}
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		inputs = append(inputs, input)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestOpenURLReaderFormats(t *testing.T) {
+	gzipped := new(bytes.Buffer)
+	gz := gzip.NewWriter(gzipped)
+	gz.Write([]byte("https://example.com/a\nhttps://example.com/b\n"))
+	gz.Close()
+
+	zstded := new(bytes.Buffer)
+	zw, _ := zstd.NewWriter(zstded)
+	zw.Write([]byte(`{"url": "https://example.com/a"}` + "\n" + `{"url": "https://example.com/b"}` + "\n"))
+	zw.Close()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		options InputOptions
+	}{
+		{"csv first column", "urls.csv", "https://example.com/a,sku-1\n\n,sku-2\nhttps://example.com/b\n", InputOptions{Delimiter: ","}},
+		{"csv delimiter", "urls.tsv", "https://example.com/a\tsku-1\nhttps://example.com/b\tsku-2\n", InputOptions{Delimiter: "\t"}},
+		{"text", "urls.txt", "# products\nhttps://example.com/a\n\n  https://example.com/b  \n", InputOptions{}},
+		{"text format", "urls", "https://example.com/a\nhttps://example.com/b\n", InputOptions{Format: INPUT_TEXT}},
+		{"jsonl", "urls.jsonl", `{"url": "https://example.com/a"}` + "\n" + `{"sku": "none"}` + "\n" + `{"url": "https://example.com/b"}` + "\n", InputOptions{}},
+		{"jsonl nested field", "urls.ndjson", `{"page": {"link": "https://example.com/a"}}` + "\n" + `{"page": "flat"}` + "\n" + `{"page": {"link": "https://example.com/b"}}`, InputOptions{URLField: "page.link"}},
+		{"gzip text", "urls.txt.gz", gzipped.String(), InputOptions{}},
+		{"zstd jsonl", "urls.jsonl.zst", zstded.String(), InputOptions{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := writeTestFile(t, tt.file, tt.content)
+			inputs := readTestURLs(t, name, tt.options)
+			if len(inputs) != 2 || inputs[0].URL != "https://example.com/a" || inputs[1].URL != "https://example.com/b" {
+				t.Errorf("unexpected URLs %v", inputs)
+			}
+			for _, input := range inputs {
+				if input.Columns != nil {
+					t.Errorf("expected no Pass Through Columns, got %v", input.Columns)
+				}
+			}
+		})
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestCSVURLReaderColumns(t *testing.T) {
+	const content = "sku,link,category\nA-1,https://example.com/a,shoes\nB-1,https://example.com/b\n"
+
+	tests := []struct {
+		name     string
+		options  InputOptions
+		columns  string
+		expected string
+	}{
+		{"by name", InputOptions{URLColumn: "link", PassThrough: true}, "sku,category", "https://example.com/a sku=A-1 category=shoes|https://example.com/b sku=B-1 category="},
+		{"by index with header", InputOptions{URLColumn: "2", Header: true, PassThrough: true}, "sku,category", "https://example.com/a sku=A-1 category=shoes|https://example.com/b sku=B-1 category="},
+		{"by index without header", InputOptions{URLColumn: "2", PassThrough: true}, "column_1,column_3", "link column_1=sku column_3=category|https://example.com/a column_1=A-1 column_3=shoes|https://example.com/b column_1=B-1 column_3="},
+		{"not passed through", InputOptions{URLColumn: "link"}, "", "https://example.com/a|https://example.com/b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.Delimiter = ","
+			name := writeTestFile(t, "urls.csv", content)
+
+			reader, err := OpenURLReader(name, tt.options)
+			if err != nil {
+				t.Fatalf("OpenURLReader failed: %v", err)
+			}
+			columns := strings.Join(reader.Columns(), ",")
+			reader.Close()
+			if columns != tt.columns {
+				t.Errorf("expected columns %q, got %q", tt.columns, columns)
+			}
+
+			var rows []string
+			for _, input := range readTestURLs(t, name, tt.options) {
+				row := input.URL
+				for _, column := range input.Columns {
+					row += " " + column.Name + "=" + column.Value
+				}
+				rows = append(rows, row)
+			}
+			if strings.Join(rows, "|") != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, strings.Join(rows, "|"))
+			}
+		})
+	}
+
+	// A Byte Order Mark and the spaces surrounding the names of the Header Row are ignored
+	options := InputOptions{Delimiter: ",", URLColumn: "link ", PassThrough: true}
+	name := writeTestFile(t, "urls.csv", "\ufeff\"sku\", link ,category\nA-1,https://example.com/a,shoes\n")
+	reader, err := OpenURLReader(name, options)
+	if err != nil {
+		t.Fatalf("OpenURLReader failed: %v", err)
+	}
+	if columns := strings.Join(reader.Columns(), ","); columns != "sku,category" {
+		t.Errorf("expected columns sku,category, got %q", columns)
+	}
+	reader.Close()
+	if inputs := readTestURLs(t, name, options); len(inputs) != 1 || inputs[0].URL != "https://example.com/a" {
+		t.Errorf("expected https://example.com/a, got %+v", inputs)
+	}
+
+	// A URL Column must be in the Header Row, and an index counts from 1
+	for _, column := range []string{"href", "0"} {
+		if _, err := OpenURLReader(writeTestFile(t, "urls.csv", content), InputOptions{Delimiter: ",", URLColumn: column}); err == nil {
+			t.Errorf("expected URL Column %q to fail", column)
+		}
+	}
+
+	// The Columns are keyed by name, so a name repeated in the Header Row is rejected
+	duplicated := writeTestFile(t, "urls.csv", "sku,link, sku\nA-1,https://example.com/a,A-2\n")
+	if _, err := OpenURLReader(duplicated, InputOptions{Delimiter: ",", URLColumn: "link", PassThrough: true}); err == nil {
+		t.Error("expected a duplicated Header Row name to fail")
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestOpenURLReaderErrors(t *testing.T) {
+	if _, err := OpenURLReader(writeTestFile(t, "urls.csv", ""), InputOptions{Format: "xml", Delimiter: ","}); err == nil {
+		t.Error("expected an unknown Input Format to fail")
+	}
+
+	reader, err := OpenURLReader(writeTestFile(t, "urls.jsonl", `{"url": "https://example.com/a"}`+"\n"+`{"url": `), InputOptions{})
+	if err != nil {
+		t.Fatalf("OpenURLReader failed: %v", err)
+	}
+	defer reader.Close()
+	if input, err := reader.Read(); err != nil || input.URL != "https://example.com/a" {
+		t.Fatalf("expected the first URL, got %q %v", input.URL, err)
+	}
+	if _, err := reader.Read(); err == nil || !strings.Contains(err.Error(), "Line 2") {
+		t.Errorf("expected invalid JSON on line 2 to fail, got %v", err)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestLoadUrlFileDeduplicates(t *testing.T) {
+	name := writeTestFile(t, "urls.txt", "https://example.com/a\nhttps://example.com/b\nhttps://example.com/a\n")
+
+	crawler, err := NewCrawler("", "", "", nil, 0, 1)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	if err := crawler.LoadUrlFile(name, InputOptions{Delimiter: ","}); err != nil {
+		t.Fatalf("LoadUrlFile failed: %v", err)
+	}
+	if strings.Join(crawler.URLs, ",") != "https://example.com/a,https://example.com/b" {
+		t.Errorf("unexpected URLs %v", crawler.URLs)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapePassesThroughInputColumns(t *testing.T) {
+	server := newTestServer(t)
+	content := fmt.Sprintf("url;category\n%s/product/1;shoes\n%s/product/2;hats\n", server.URL, server.URL)
+
+	crawler, err := NewCrawler("", ".sku", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	if err := crawler.LoadUrlFile(writeTestFile(t, "urls.csv", content), InputOptions{Delimiter: ";", URLColumn: "url", PassThrough: true}); err != nil {
+		t.Fatalf("LoadUrlFile failed: %v", err)
+	}
+	if strings.Join(crawler.InputColumns, ",") != "category" {
+		t.Errorf("unexpected Input Columns %v", crawler.InputColumns)
+	}
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	// Every Record carries the Columns of the row its Page was listed on
+	expected := map[string]string{server.URL + "/product/1": "shoes", server.URL + "/product/2": "hats"}
+	scraped := results.ScrapedData()
+	if len(scraped) != 4 {
+		t.Fatalf("expected 4 scraped records, got %d", len(scraped))
+	}
+	for _, record := range scraped {
+		if values := record.Input.Values([]string{"category"}); values[0] != expected[record.OriginalURL] {
+			t.Errorf("record %s of %s has unexpected Input Columns %v", record.Data, record.OriginalURL, record.Input)
+		}
+	}
+}
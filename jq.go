@@ -0,0 +1,206 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// jq Results modes, either the first value only, each value as a separate
+// Record, or all values collected into a single JSON array
+const JQ_RESULTS_FIRST = "first"
+const JQ_RESULTS_ROWS = "rows"
+const JQ_RESULTS_ARRAY = "array"
+
+// jq Variable always holding the Original URL of the Page being Scraped
+const JQ_URL_VARIABLE = "$url"
+
+var jqArgNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Error returned when the Selected Element Text is not valid JSON
+var ErrInvalidJSON = errors.New("Selected Element Text is not valid JSON")
+
+// Named jq Variable, as passed to jq using --arg
+type JQArg struct {
+	Name  string
+	Value string
+}
+
+// List of Named jq Variables, populated by a repeatable command line flag
+type JQArgs []JQArg
+
+// Compiled 'jq' Selector along with the values of its Named Variables,
+// excluding the Page URL which is passed on every execution
+type JQSelector struct {
+	code   *gojq.Code
+	values []any
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Named jq Variables as a flag value
+func (a *JQArgs) String() string {
+	var args []string
+	for _, arg := range *a {
+		args = append(args, fmt.Sprintf("%s=%s", arg.Name, arg.Value))
+	}
+	return strings.Join(args, ",")
+}
+
+//---------------------------------------------------------------------------------------
+
+// Append a Named jq Variable provided as name=value
+func (a *JQArgs) Set(value string) error {
+
+	name, argValue, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("jq Variable must be provided as name=value")
+	}
+
+	name = strings.TrimPrefix(name, "$")
+	if !jqArgNamePattern.MatchString(name) {
+		return fmt.Errorf("jq Variable Name is Invalid: %s", name)
+	}
+	if "$"+name == JQ_URL_VARIABLE {
+		return fmt.Errorf("jq Variable Name is Reserved: %s", name)
+	}
+
+	*a = append(*a, JQArg{Name: name, Value: argValue})
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a JQSelector, Parsing and Compiling the query once
+// with any jq function definitions prepended. An empty query returns nil,
+// which selects the value unchanged.
+func NewJQSelector(query string, definitions string, args JQArgs) (*JQSelector, error) {
+
+	if query == "" {
+		return nil, nil
+	}
+
+	// Parse the jq selector text, function definitions must precede the query
+	jq, err := gojq.Parse(definitions + "\n" + query)
+	if err != nil {
+		return nil, fmt.Errorf("jq Selector Parse Failed: %w", err)
+	}
+
+	// Declare the Page URL and each Named Variable, in the order the values are passed
+	names := []string{JQ_URL_VARIABLE}
+	var values []any
+	for _, arg := range args {
+		names = append(names, "$"+arg.Name)
+		values = append(values, arg.Value)
+	}
+
+	// Compile the jq selector, which also resolves every function and variable reference
+	code, err := gojq.Compile(jq, gojq.WithVariables(names))
+	if err != nil {
+		return nil, fmt.Errorf("jq Selector Compile Failed: %w", err)
+	}
+
+	return &JQSelector{code: code, values: values}, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Execute the 'jq' Selector against the JSON Object text returned
+func (s *JQSelector) SelectText(selectedText string, pageURL string, mode string) ([]string, error) {
+
+	// If the JSON Selector Query was NOT provided then return the element text
+	if s == nil {
+		return []string{selectedText}, nil
+	}
+
+	// Convert the element text to a JSON value before querying
+	var jsonData any
+	if err := json.Unmarshal([]byte(selectedText), &jsonData); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJSON, err)
+	}
+
+	return s.SelectValue(jsonData, pageURL, mode)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Execute the 'jq' Selector against an already parsed JSON value, returning
+// the raw JSON of the values emitted as required by the jq Results mode. Any
+// values emitted either side of an error are returned alongside the error.
+func (s *JQSelector) SelectValue(jsonData any, pageURL string, mode string) ([]string, error) {
+
+	// If the JSON Selector Query was NOT provided then return the value as raw JSON
+	if s == nil {
+		rawJSON, err := json.Marshal(jsonData)
+		if err != nil {
+			return nil, fmt.Errorf("JSON Value Marshal Failed: %w", err)
+		}
+		return []string{string(rawJSON)}, nil
+	}
+
+	// Pass the Page URL as the first variable value
+	values := append([]any{pageURL}, s.values...)
+
+	// Execute the jq Selector against the element text, only the first value is
+	// required unless returning all values as rows or as a single array
+	var selected []any
+	var errs []error
+	jqSelector := s.code.Run(jsonData, values...)
+	for {
+		val, ok := jqSelector.Next()
+		if !ok {
+			break
+		}
+
+		// Record any value returned which is actually an error, a halt ends the iteration
+		if err, ok := val.(error); ok {
+			errs = append(errs, fmt.Errorf("jq Selector Run Failed: %w", err))
+			var haltErr *gojq.HaltError
+			if mode == JQ_RESULTS_FIRST || errors.As(err, &haltErr) {
+				break
+			}
+			continue
+		}
+
+		selected = append(selected, val)
+		if mode == JQ_RESULTS_FIRST {
+			break
+		}
+	}
+
+	// Collect all values into a single JSON array if required
+	if mode == JQ_RESULTS_ARRAY && len(selected) > 0 {
+		selected = []any{selected}
+	}
+
+	// Convert each value returned to a raw JSON string
+	var rawValues []string
+	for _, val := range selected {
+		rawJSON, err := json.Marshal(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("jq Selector Value Marshal Failed: %w", err))
+			continue
+		}
+		rawValues = append(rawValues, string(rawJSON))
+	}
+
+	return rawValues, errors.Join(errs...)
+}
@@ -0,0 +1,122 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJQSelectValueResultsModes(t *testing.T) {
+	var product any
+	_ = json.Unmarshal([]byte(`{"offers": [{"price": 1}, {"price": 2}, {"price": 3}]}`), &product)
+
+	tests := []struct {
+		mode     string
+		expected []string
+	}{
+		{JQ_RESULTS_FIRST, []string{`{"price":1}`}},
+		{JQ_RESULTS_ROWS, []string{`{"price":1}`, `{"price":2}`, `{"price":3}`}},
+		{JQ_RESULTS_ARRAY, []string{`[{"price":1},{"price":2},{"price":3}]`}},
+	}
+
+	jq, err := NewJQSelector(".offers[]", "", nil)
+	if err != nil {
+		t.Fatalf("NewJQSelector failed: %v", err)
+	}
+
+	for _, test := range tests {
+		selected, err := jq.SelectValue(product, "https://example.com/", test.mode)
+		if err != nil {
+			t.Fatalf("%s: SelectValue failed: %v", test.mode, err)
+		}
+		if strings.Join(selected, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("%s: expected %v, got %v", test.mode, test.expected, selected)
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestJQSelectValueReportsLaterErrors(t *testing.T) {
+	var product any
+	_ = json.Unmarshal([]byte(`{"offers": [{"price": "1"}, {"price": "free"}]}`), &product)
+
+	jq, err := NewJQSelector(".offers[].price | tonumber", "", nil)
+	if err != nil {
+		t.Fatalf("NewJQSelector failed: %v", err)
+	}
+
+	selected, err := jq.SelectValue(product, "https://example.com/", JQ_RESULTS_ROWS)
+	if err == nil {
+		t.Fatal("expected the error from the second value to be reported")
+	}
+	if len(selected) != 1 || selected[0] != "1" {
+		t.Errorf("expected the first value to be kept, got %v", selected)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestJQSelectorVariablesAndDefinitions(t *testing.T) {
+	var args JQArgs
+	if err := args.Set("currency=AUD"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	jq, err := NewJQSelector(`{url: $url, price: price_of(.offers), currency: $currency}`, `def price_of(o): o.price;`, args)
+	if err != nil {
+		t.Fatalf("NewJQSelector failed: %v", err)
+	}
+
+	selected, err := jq.SelectText(`{"offers": {"price": 10}}`, "https://example.com/a", JQ_RESULTS_FIRST)
+	if err != nil {
+		t.Fatalf("SelectText failed: %v", err)
+	}
+
+	expected := `{"currency":"AUD","price":10,"url":"https://example.com/a"}`
+	if len(selected) != 1 || selected[0] != expected {
+		t.Errorf("expected %s, got %v", expected, selected)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestNewJQSelectorFailsFast(t *testing.T) {
+	for _, query := range []string{".offers[", ".offers | unknown_function", "$undefined"} {
+		if _, err := NewJQSelector(query, "", nil); err == nil {
+			t.Errorf("expected an error for the query %q", query)
+		}
+	}
+
+	if _, err := NewCrawler("", ".offers[", "", nil, 0, 1); err == nil {
+		t.Error("expected NewCrawler to report the invalid jq Selector")
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestJQArgsSet(t *testing.T) {
+	var args JQArgs
+	for _, value := range []string{"missing", "1abc=x", "url=x"} {
+		if err := args.Set(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+	if err := args.Set("$sku=a=b"); err != nil || args[0] != (JQArg{Name: "sku", Value: "a=b"}) {
+		t.Errorf("expected sku=a=b to be accepted, got %v, %v", args, err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Data Sink writing each Scraped Record as a JSON Object, either one per
+// line as JSON Lines or as the elements of a single JSON Array
+type JSONDataSink struct {
+	file    *os.File
+	array   bool
+	started bool
+	records int
+}
+
+// JSON Object written for each Scraped Record
+type jsonRecord struct {
+	URL          string       `json:"url"`
+	FinalURL     string       `json:"final_url"`
+	StatusCode   int          `json:"status_code"`
+	FetchedAt    time.Time    `json:"fetched_at"`
+	ElementIndex int          `json:"element_index"`
+	Type         string       `json:"type,omitempty"`
+	Syntax       string       `json:"syntax"`
+	Data         any          `json:"data"`
+	Input        InputColumns `json:"input,omitempty"`
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a JSON Data Sink writing to the named File, as a
+// single JSON Array if requested, otherwise as JSON Lines
+func NewJSONDataSink(name string, array bool, resume bool) (*JSONDataSink, error) {
+
+	// Reopen the JSON Array of a previous crawl so further elements can be added
+	if array && resume {
+		return reopenJSONArray(name)
+	}
+
+	// Open file ready for writing
+	file, err := openOutputFile(name, resume)
+	if err != nil {
+		return nil, fmt.Errorf("[NewJSONDataSink] %w", err)
+	}
+
+	return &JSONDataSink{file: file, array: array}, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Open the named File holding a JSON Array for further elements, removing the
+// closing bracket if the previous crawl wrote one before it was interrupted
+func reopenJSONArray(name string) (*JSONDataSink, error) {
+
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, fmt.Errorf("[reopenJSONArray] Open File Failed: %w", err)
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("[reopenJSONArray] Read File Failed: %w", err)
+	}
+
+	s := &JSONDataSink{file: file, array: true}
+	content = bytes.TrimRight(content, " \t\r\n")
+	content = bytes.TrimSuffix(content, []byte("]"))
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 {
+		if trimmed[0] != '[' {
+			file.Close()
+			return nil, fmt.Errorf("[reopenJSONArray] File does not hold a JSON Array: %s", name)
+		}
+		s.started = true
+		if len(trimmed) > 1 {
+			s.records = 1
+		}
+	}
+
+	// Drop the closing bracket, the next element is written after the last one
+	content = bytes.TrimRight(content, " \t\r\n")
+	if err := file.Truncate(int64(len(content))); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("[reopenJSONArray] Truncate File Failed: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("[reopenJSONArray] Seek File Failed: %w", err)
+	}
+
+	return s, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Write the Scraped Record to the File as a JSON Object, keeping the Data as
+// JSON when it is valid JSON, otherwise as a JSON string
+func (s *JSONDataSink) WriteRecord(record ScrapedRecord) error {
+
+	var data any = record.Data
+	if json.Valid([]byte(record.Data)) {
+		data = json.RawMessage(record.Data)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(jsonRecord{
+		URL:          record.OriginalURL,
+		FinalURL:     record.FinalURL,
+		StatusCode:   record.StatusCode,
+		FetchedAt:    record.FetchedAt,
+		ElementIndex: record.ElementIndex,
+		Type:         record.Type,
+		Syntax:       record.Syntax,
+		Data:         data,
+		Input:        record.Input,
+	})
+	if err != nil {
+		return fmt.Errorf("[WriteRecord] JSON Encode Failed: %w", err)
+	}
+
+	// Separate the JSON Array elements in place of the newline appended by the Encoder
+	output := buf.Bytes()
+	if s.array {
+		separator := ",\n"
+		if !s.started {
+			separator = "[\n"
+		} else if s.records == 0 {
+			separator = "\n"
+		}
+		output = append([]byte(separator), bytes.TrimSuffix(output, []byte("\n"))...)
+		s.started = true
+	}
+
+	if _, err := s.file.Write(output); err != nil {
+		return fmt.Errorf("[WriteRecord] Failed Writing to the File: %w", err)
+	}
+	s.records++
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Close the JSON Array if required, then Close the File
+func (s *JSONDataSink) Close() error {
+
+	if s.array {
+		closing := "\n]\n"
+		if !s.started {
+			closing = "[]\n"
+		}
+		if _, err := s.file.WriteString(closing); err != nil {
+			s.file.Close()
+			return fmt.Errorf("[Close] Failed Writing to the File: %w", err)
+		}
+	}
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("[Close] Failed Closing the File: %w", err)
+	}
+
+	return nil
+}
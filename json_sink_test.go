@@ -0,0 +1,131 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Records written by the JSON Data Sink tests, the second holds non JSON text
+var jsonTestRecords = []ScrapedRecord{
+	{
+		OriginalURL:  "https://example.com/a",
+		FinalURL:     "https://www.example.com/a",
+		StatusCode:   200,
+		FetchedAt:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		ElementIndex: 0,
+		Type:         "Product",
+		Syntax:       SYNTAX_JSONLD,
+		Data:         "{\"name\": \"A\", \"description\": \"line one\\nline two <b>\"}",
+		Input:        InputColumns{{Name: "sku", Value: "A-1"}, {Name: "category", Value: "shoes"}},
+	},
+	{
+		OriginalURL:  "https://example.com/b",
+		FinalURL:     "https://example.com/b",
+		StatusCode:   200,
+		FetchedAt:    time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC),
+		ElementIndex: 1,
+		Syntax:       SYNTAX_ELEMENT,
+		Data:         "plain\ntext",
+	},
+}
+
+// Write the test records with a new JSON Data Sink, returning the File content
+func writeJSONTestRecords(t *testing.T, array bool, records []ScrapedRecord) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "results.json")
+	sink, err := NewJSONDataSink(name, array, false)
+	if err != nil {
+		t.Fatalf("NewJSONDataSink failed: %v", err)
+	}
+	for _, record := range records {
+		if err := sink.WriteRecord(record); err != nil {
+			t.Fatalf("WriteRecord failed: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return string(content)
+}
+
+func TestJSONDataSinkLines(t *testing.T) {
+	expected := `{"url":"https://example.com/a","final_url":"https://www.example.com/a","status_code":200,"fetched_at":"2024-01-02T03:04:05Z","element_index":0,"type":"Product","syntax":"json-ld","data":{"name":"A","description":"line one\nline two <b>"},"input":{"sku":"A-1","category":"shoes"}}` + "\n" +
+		`{"url":"https://example.com/b","final_url":"https://example.com/b","status_code":200,"fetched_at":"2024-01-02T03:04:06Z","element_index":1,"syntax":"element","data":"plain\ntext"}` + "\n"
+
+	if content := writeJSONTestRecords(t, false, jsonTestRecords); content != expected {
+		t.Errorf("expected %s\ngot      %s", expected, content)
+	}
+}
+
+func TestJSONDataSinkArray(t *testing.T) {
+	var records []map[string]any
+	if err := json.Unmarshal([]byte(writeJSONTestRecords(t, true, jsonTestRecords)), &records); err != nil {
+		t.Fatalf("output is not a valid JSON array: %v", err)
+	}
+	if len(records) != len(jsonTestRecords) {
+		t.Fatalf("expected %d records, got %d", len(jsonTestRecords), len(records))
+	}
+	if name := records[0]["data"].(map[string]any)["name"]; name != "A" {
+		t.Errorf("expected data to be kept as a JSON object, got %v", records[0]["data"])
+	}
+
+	if content := writeJSONTestRecords(t, true, nil); content != "[]\n" {
+		t.Errorf("expected an empty JSON array, got %q", content)
+	}
+}
+
+func TestJSONDataSinkArrayAppend(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "results.json")
+
+	// Each crawl writes a single record, the second Appending to the first
+	for i, record := range jsonTestRecords {
+		sink, err := NewJSONDataSink(name, true, i > 0)
+		if err != nil {
+			t.Fatalf("NewJSONDataSink failed: %v", err)
+		}
+		if err := sink.WriteRecord(record); err != nil {
+			t.Fatalf("WriteRecord failed: %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	var records []map[string]any
+	if err := json.Unmarshal(content, &records); err != nil {
+		t.Fatalf("output is not a valid JSON array: %v\n%s", err, content)
+	}
+	if len(records) != len(jsonTestRecords) {
+		t.Fatalf("expected %d records, got %d", len(jsonTestRecords), len(records))
+	}
+	if records[1]["url"] != jsonTestRecords[1].OriginalURL {
+		t.Errorf("expected the appended record last, got %v", records[1]["url"])
+	}
+}
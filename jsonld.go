@@ -0,0 +1,213 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+const JSONLD_SELECTOR = "script[type]"
+const JSONLD_MEDIA_TYPE = "application/ld+json"
+
+// Wrappers found around the JSON-LD Script Block text, removed in order
+var jsonldPrefixes = []string{"<!--", "//<![CDATA[", "/*<![CDATA[*/", "<![CDATA["}
+var jsonldSuffixes = []string{"-->", "//]]>", "/*]]>*/", "]]>"}
+
+//---------------------------------------------------------------------------------------
+
+// Check if the Script Block type attribute is the JSON-LD media type
+func isJSONLDType(scriptType string) bool {
+	mediaType, _, err := mime.ParseMediaType(scriptType)
+	if err != nil {
+		return false
+	}
+	return mediaType == JSONLD_MEDIA_TYPE
+}
+
+//---------------------------------------------------------------------------------------
+
+// Parse the JSON-LD Script Block text returning every top level JSON value,
+// tolerating the HTML comments, CDATA wrappers and trailing commas found on
+// real sites. Values successfully parsed before an error are still returned.
+func parseJSONLD(text string) ([]any, error) {
+
+	decoder := json.NewDecoder(strings.NewReader(sanitiseJSONLD(unwrapJSONLD(text))))
+
+	var values []any
+	for {
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			if errors.Is(err, io.EOF) {
+				return values, nil
+			}
+			return values, fmt.Errorf("JSON-LD Script Block is not valid JSON: %w", err)
+		}
+		values = append(values, value)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Remove the HTML comment and CDATA wrappers from around the JSON-LD text
+func unwrapJSONLD(text string) string {
+
+	text = strings.TrimSpace(text)
+	for unwrapped := false; !unwrapped; {
+		unwrapped = true
+		for _, prefix := range jsonldPrefixes {
+			if strings.HasPrefix(text, prefix) {
+				text = strings.TrimSpace(strings.TrimPrefix(text, prefix))
+				unwrapped = false
+			}
+		}
+		for _, suffix := range jsonldSuffixes {
+			if strings.HasSuffix(text, suffix) {
+				text = strings.TrimSpace(strings.TrimSuffix(text, suffix))
+				unwrapped = false
+			}
+		}
+	}
+
+	return text
+}
+
+//---------------------------------------------------------------------------------------
+
+// Remove trailing commas before a closing bracket or brace, and escape raw
+// control characters within strings, leaving the remaining text untouched
+func sanitiseJSONLD(text string) string {
+
+	var b strings.Builder
+	b.Grow(len(text))
+
+	inString := false
+	escaped := false
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+
+		// Within a string only control characters need attention
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			case ch == '\n':
+				b.WriteString(`\n`)
+				continue
+			case ch == '\r':
+				b.WriteString(`\r`)
+				continue
+			case ch == '\t':
+				b.WriteString(`\t`)
+				continue
+			case ch < 0x20:
+				fmt.Fprintf(&b, `\u%04x`, ch)
+				continue
+			}
+			b.WriteByte(ch)
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inString = true
+		case ',':
+			// Drop the comma if the next significant character closes the object or array
+			next := strings.TrimLeft(text[i+1:], " \t\r\n")
+			if len(next) > 0 && (next[0] == '}' || next[0] == ']') {
+				continue
+			}
+		}
+		b.WriteByte(ch)
+	}
+
+	return b.String()
+}
+
+//---------------------------------------------------------------------------------------
+
+// Expand a top level JSON array and any JSON-LD @graph container into its
+// individual members, each member inheriting the container @context if it
+// has none of its own
+func expandJSONLD(value any) []any {
+
+	switch v := value.(type) {
+	case []any:
+		var expanded []any
+		for _, member := range v {
+			expanded = append(expanded, expandJSONLD(member)...)
+		}
+		return expanded
+
+	case map[string]any:
+		graph, ok := v["@graph"]
+		if !ok {
+			return []any{v}
+		}
+
+		// A @graph holding a single node is treated as a one member array
+		members, ok := graph.([]any)
+		if !ok {
+			members = []any{graph}
+		}
+
+		var expanded []any
+		for _, member := range expandJSONLD(members) {
+			if node, ok := member.(map[string]any); ok {
+				if _, ok := node["@context"]; !ok && v["@context"] != nil {
+					node["@context"] = v["@context"]
+				}
+			}
+			expanded = append(expanded, member)
+		}
+		return expanded
+	}
+
+	return []any{value}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the JSON-LD @type of the value, multiple types are comma separated
+func jsonldType(value any) string {
+
+	node, ok := value.(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	switch t := node["@type"].(type) {
+	case string:
+		return t
+	case []any:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return strings.Join(types, ",")
+	}
+
+	return ""
+}
@@ -0,0 +1,161 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseJSONLD(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "plain object",
+			text:     `{"@type": "Product", "name": "A"}`,
+			expected: []string{`{"@type":"Product","name":"A"}`},
+		},
+		{
+			name:     "html comment wrapper",
+			text:     "<!--\n{\"@type\": \"Product\"}\n-->",
+			expected: []string{`{"@type":"Product"}`},
+		},
+		{
+			name:     "cdata wrapper",
+			text:     "//<![CDATA[\n{\"@type\": \"Product\"}\n//]]>",
+			expected: []string{`{"@type":"Product"}`},
+		},
+		{
+			name:     "trailing commas",
+			text:     `{"@type": "Product", "image": ["a.jpg", "b.jpg", ], "offers": {"price": 1,},}`,
+			expected: []string{`{"@type":"Product","image":["a.jpg","b.jpg"],"offers":{"price":1}}`},
+		},
+		{
+			name:     "comma within string is kept",
+			text:     `{"name": "A, }"}`,
+			expected: []string{`{"name":"A, }"}`},
+		},
+		{
+			name:     "raw control characters within string",
+			text:     "{\"description\": \"line one\nline two\t\"}",
+			expected: []string{`{"description":"line one\nline two\t"}`},
+		},
+		{
+			name:     "multiple top level objects",
+			text:     `{"@type": "Product"} {"@type": "Organization"}`,
+			expected: []string{`{"@type":"Product"}`, `{"@type":"Organization"}`},
+		},
+		{
+			name:     "empty script block",
+			text:     "  \n ",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := parseJSONLD(test.text)
+			if err != nil {
+				t.Fatalf("parseJSONLD failed: %v", err)
+			}
+			if len(values) != len(test.expected) {
+				t.Fatalf("expected %d values, got %d", len(test.expected), len(values))
+			}
+			for i, value := range values {
+				rawJSON, _ := json.Marshal(value)
+				if string(rawJSON) != test.expected[i] {
+					t.Errorf("expected %s, got %s", test.expected[i], rawJSON)
+				}
+			}
+		})
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestParseJSONLDKeepsValuesBeforeError(t *testing.T) {
+	values, err := parseJSONLD(`{"@type": "Product"} {"broken": }`)
+	if err == nil {
+		t.Fatal("expected an error for the invalid second value")
+	}
+	if len(values) != 1 {
+		t.Errorf("expected the first value to be returned, got %d values", len(values))
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestIsJSONLDType(t *testing.T) {
+	for scriptType, expected := range map[string]bool{
+		"application/ld+json":                true,
+		"Application/LD+JSON":                true,
+		"application/ld+json; charset=utf-8": true,
+		"application/json":                   false,
+		"text/javascript":                    false,
+		"":                                   false,
+	} {
+		if got := isJSONLDType(scriptType); got != expected {
+			t.Errorf("isJSONLDType(%q) = %v, expected %v", scriptType, got, expected)
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExpandJSONLD(t *testing.T) {
+	values, err := parseJSONLD(`{
+		"@context": "https://schema.org",
+		"@graph": [
+			{"@type": "WebPage", "@id": "#page"},
+			{"@type": ["Product", "IndividualProduct"], "name": "A"},
+			{"@context": "https://example.com", "@type": "Thing"}
+		]
+	}
+	[{"@type": "Organization"}, "not a node"]`)
+	if err != nil {
+		t.Fatalf("parseJSONLD failed: %v", err)
+	}
+
+	var expanded []any
+	for _, value := range values {
+		expanded = append(expanded, expandJSONLD(value)...)
+	}
+
+	expected := []struct {
+		json  string
+		jtype string
+	}{
+		{`{"@context":"https://schema.org","@id":"#page","@type":"WebPage"}`, "WebPage"},
+		{`{"@context":"https://schema.org","@type":["Product","IndividualProduct"],"name":"A"}`, "Product,IndividualProduct"},
+		{`{"@context":"https://example.com","@type":"Thing"}`, "Thing"},
+		{`{"@type":"Organization"}`, "Organization"},
+		{`"not a node"`, ""},
+	}
+	if len(expanded) != len(expected) {
+		t.Fatalf("expected %d members, got %d", len(expected), len(expanded))
+	}
+	for i, member := range expanded {
+		rawJSON, _ := json.Marshal(member)
+		if string(rawJSON) != expected[i].json {
+			t.Errorf("member %d: expected %s, got %s", i, expected[i].json, rawJSON)
+		}
+		if got := jsonldType(member); got != expected[i].jtype {
+			t.Errorf("member %d: expected @type %q, got %q", i, expected[i].jtype, got)
+		}
+	}
+}
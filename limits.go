@@ -0,0 +1,316 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time allowed for each Request, from when it is made until the Response Body is read
+const REQUEST_TIMEOUT = 120 * time.Second
+
+// Concurrent Requests and Requests per Second allowed to a Domain, either
+// value is inherited from the Request Limiter defaults when not provided
+type DomainLimit struct {
+	Domain      string   `json:"-"`
+	Parallelism *int     `json:"parallelism"`
+	RPS         *float64 `json:"rps"`
+}
+
+// Limits the Requests made by the Collector, both in total and to each Domain, in
+// place of a single Colly Limit Rule which shares its Parallelism across every Domain
+type RequestLimiter struct {
+	slots             chan struct{}
+	randomDelay       time.Duration
+	DomainParallelism int
+	DomainRPS         float64
+	DomainLimits      []DomainLimit
+	Adaptive          bool
+	lock              sync.Mutex
+	domains           map[string]*domainLimiter
+}
+
+// Concurrent Request slots and Request pacing of a single Domain, along with
+// the state of the Adaptive Throttling when enabled
+type domainLimiter struct {
+	slots        chan struct{}
+	lock         sync.Mutex
+	interval     time.Duration
+	next         time.Time
+	adaptive     bool
+	rps          float64
+	maxRPS       float64
+	latency      time.Duration
+	samples      int
+	lastDecrease time.Time
+}
+
+// HTTP Transport waiting for the Request Limiter before each Request is made,
+// only then starting the Request Timeout
+type limitTransport struct {
+	http.RoundTripper
+	limiter  *RequestLimiter
+	timeout  time.Duration
+	stopping <-chan struct{}
+}
+
+// Response Body releasing the Request Limiter slots once Closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a Request Limiter allowing the given Concurrent Requests in total,
+// each holding its slot for a Random Delay after the Response, with no Domain limits
+func NewRequestLimiter(parallelism int, randomDelay time.Duration) *RequestLimiter {
+	return &RequestLimiter{
+		slots:       make(chan struct{}, max(parallelism, 1)),
+		randomDelay: randomDelay,
+		domains:     make(map[string]*domainLimiter),
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Load the Domain Limits from a JSON File holding an object of Domain glob to
+// limits, keeping the order the globs appear in the File as the first match wins
+func LoadDomainLimitsFile(name string) ([]DomainLimit, error) {
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("[LoadDomainLimitsFile] Read File Failed: %w", err)
+	}
+
+	// Decode the object token by token, as decoding into a map loses the order
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("[LoadDomainLimitsFile] File must contain a JSON Object of Domain glob to limits")
+	}
+
+	var limits []DomainLimit
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("[LoadDomainLimitsFile] JSON Decode Failed: %w", err)
+		}
+		domain := strings.ToLower(token.(string))
+		if _, err := path.Match(domain, ""); err != nil || domain == "" {
+			return nil, fmt.Errorf("[LoadDomainLimitsFile] Invalid Domain glob: %s", domain)
+		}
+
+		limit := DomainLimit{Domain: domain}
+		if err := decoder.Decode(&limit); err != nil {
+			return nil, fmt.Errorf("[LoadDomainLimitsFile] Limits for %s must be an object of parallelism and rps: %w", domain, err)
+		}
+		if (limit.Parallelism != nil && *limit.Parallelism < 0) || (limit.RPS != nil && *limit.RPS < 0) {
+			return nil, fmt.Errorf("[LoadDomainLimitsFile] Limits for %s must not be negative", domain)
+		}
+		limits = append(limits, limit)
+	}
+
+	return limits, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Limiter of the Domain, created on first use from the first matching
+// Domain Limit, otherwise from the defaults. A value of 0 allows Requests without limit,
+// except when Adaptive, where the Requests per Second then start from a default rate.
+func (l *RequestLimiter) domain(hostname string) *domainLimiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	hostname = strings.ToLower(hostname)
+	if d, ok := l.domains[hostname]; ok {
+		return d
+	}
+
+	parallelism, rps := l.DomainParallelism, l.DomainRPS
+	for _, limit := range l.DomainLimits {
+		if matched, _ := path.Match(limit.Domain, hostname); matched {
+			if limit.Parallelism != nil {
+				parallelism = *limit.Parallelism
+			}
+			if limit.RPS != nil {
+				rps = *limit.RPS
+			}
+			break
+		}
+	}
+
+	d := new(domainLimiter)
+	if parallelism > 0 {
+		d.slots = make(chan struct{}, parallelism)
+	}
+	if l.Adaptive {
+		if rps <= 0 {
+			rps = DEFAULT_ADAPTIVE_RPS
+		}
+		d.startAdaptive(rps)
+	} else if rps > 0 {
+		d.interval = time.Duration(float64(time.Second) / rps)
+	}
+	l.domains[hostname] = d
+
+	return d
+}
+
+//---------------------------------------------------------------------------------------
+
+// Wait for a slot of the Domain, then its next Request time, and finally a slot in total,
+// so Requests waiting on a busy Domain never hold a slot another Domain could use.
+// Returns the Limiter of the Domain along with the function releasing the slots, or
+// ErrShutdown if Stopped while waiting.
+func (l *RequestLimiter) acquire(hostname string, stopping <-chan struct{}) (*domainLimiter, func(), error) {
+
+	d := l.domain(hostname)
+	if d.slots != nil {
+		select {
+		case d.slots <- struct{}{}:
+		case <-stopping:
+			return nil, nil, ErrShutdown
+		}
+	}
+	releaseDomain := func() {
+		if d.slots != nil {
+			<-d.slots
+		}
+	}
+
+	if wait := d.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-stopping:
+			timer.Stop()
+			releaseDomain()
+			return nil, nil, ErrShutdown
+		}
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	case <-stopping:
+		releaseDomain()
+		return nil, nil, ErrShutdown
+	}
+
+	// Hold both slots for the Random Delay, spacing out the Requests in the same way as Colly
+	release := func() {
+		var delay time.Duration
+		if l.randomDelay > 0 {
+			delay = time.Duration(rand.Int63n(int64(l.randomDelay)))
+		}
+		time.AfterFunc(delay, func() {
+			<-l.slots
+			releaseDomain()
+		})
+	}
+
+	return d, release, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Reserve the next Request time of the Domain, returning how long to wait for it
+func (d *domainLimiter) reserve() time.Duration {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.interval == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	if d.next.Before(now) {
+		d.next = now
+	}
+	wait := d.next.Sub(now)
+	d.next = d.next.Add(d.interval)
+
+	return wait
+}
+
+//---------------------------------------------------------------------------------------
+
+// Slow the Domain to no more than one Request per Crawl-delay, lowering the
+// highest rate the Domain may Adapt to when Adaptive
+func (d *domainLimiter) applyCrawlDelay(delay time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.adaptive {
+		d.maxRPS = min(d.maxRPS, float64(time.Second)/float64(delay))
+		d.rps = min(d.rps, d.maxRPS)
+		d.interval = time.Duration(float64(time.Second) / d.rps)
+		return
+	}
+
+	d.interval = max(d.interval, delay)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Make the Request once the Request Limiter allows, holding the slots and the
+// Request Timeout until the Response Body is Closed. The Response Status Code and
+// Latency, or the Error, Adapt the Requests per Second of the Domain if enabled.
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	hostname := req.URL.Hostname()
+	d, releaseSlots, err := t.limiter.acquire(hostname, t.stopping)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	release := func() {
+		cancel()
+		releaseSlots()
+	}
+
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		d.observe(hostname, 0, 0, err)
+		release()
+		return nil, err
+	}
+	d.observe(hostname, resp.StatusCode, time.Since(start), nil)
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+
+	return resp, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Close the Response Body and release the Request Limiter slots, only once
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
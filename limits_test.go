@@ -0,0 +1,126 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadDomainLimitsFile(t *testing.T) {
+	limits, err := LoadDomainLimitsFile(writeTestFile(t, "limits.json", `{
+		"*.Example.com": {"parallelism": 1, "rps": 0.5},
+		"example.org": {"rps": 2},
+		"*": {"parallelism": 8}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadDomainLimitsFile failed: %v", err)
+	}
+
+	l := NewRequestLimiter(100, 0)
+	l.DomainParallelism = 4
+	l.DomainRPS = 10
+	l.DomainLimits = limits
+
+	tests := []struct {
+		hostname    string
+		parallelism int
+		interval    time.Duration
+	}{
+		{"www.example.com", 1, 2 * time.Second},
+		{"example.org", 4, 500 * time.Millisecond},
+		{"example.net", 8, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		d := l.domain(tt.hostname)
+		if cap(d.slots) != tt.parallelism || d.interval != tt.interval {
+			t.Errorf("%s: expected parallelism %d and interval %v, got %d and %v", tt.hostname, tt.parallelism, tt.interval, cap(d.slots), d.interval)
+		}
+	}
+
+	for _, content := range []string{`[]`, `{"[": {}}`, `{"example.com": {"rps": -1}}`, `{"example.com": 1}`} {
+		if _, err := LoadDomainLimitsFile(writeTestFile(t, "limits.json", content)); err == nil {
+			t.Errorf("expected an error loading %s", content)
+		}
+	}
+}
+
+func TestDomainLimiterPacesRequests(t *testing.T) {
+	d := &domainLimiter{interval: 100 * time.Millisecond}
+
+	var waits []time.Duration
+	for i := 0; i < 3; i++ {
+		waits = append(waits, d.reserve().Round(50*time.Millisecond))
+	}
+	if waits[0] != 0 || waits[1] != 100*time.Millisecond || waits[2] != 200*time.Millisecond {
+		t.Errorf("expected waits of 0s, 100ms and 200ms, got %v", waits)
+	}
+}
+
+func TestExecuteScrapeDomainParallelism(t *testing.T) {
+	const pageCount = 12
+
+	// Track the most Concurrent Requests seen for each Host
+	var lock sync.Mutex
+	active := make(map[string]int)
+	peak := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Split(r.Host, ":")[0]
+		lock.Lock()
+		active[host]++
+		peak[host] = max(peak[host], active[host])
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><script type="application/ld+json">{"@type": "Thing"}</script></head></html>`)
+
+		lock.Lock()
+		active[host]--
+		lock.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	crawler, err := NewCrawler("", "", "", nil, 0, 100)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	parallelism := 1
+	crawler.ExtractJSONLD = true
+	crawler.Limiter.DomainParallelism = 3
+	crawler.Limiter.DomainLimits = []DomainLimit{{Domain: "localhost", Parallelism: &parallelism}}
+
+	// Each Host of the same Server is Limited separately
+	localhostURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	for i := 0; i < pageCount; i++ {
+		crawler.URLs = append(crawler.URLs, fmt.Sprintf("%s/page/%d", server.URL, i), fmt.Sprintf("%s/page/%d", localhostURL, i))
+	}
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+	if scraped := results.ScrapedData(); len(scraped) != pageCount*2 {
+		t.Fatalf("expected %d scraped records, got %d", pageCount*2, len(scraped))
+	}
+	if peak["127.0.0.1"] != 3 || peak["localhost"] != 1 {
+		t.Errorf("expected a peak of 3 concurrent requests to 127.0.0.1 and 1 to localhost, got %v", peak)
+	}
+}
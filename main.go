@@ -18,7 +18,10 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -33,13 +36,13 @@ var doubleIndent = "......."
 var helpText = `
 A command line application designed to crawl a given set of URLs and scrape
 the JSON Linked Data (JSON-LD) contained within the webpage before writing the
-data entries out to a CSV file.
+data entries out to a CSV, JSON Lines or JSON file.
 
 Use --help for more details.
 
 
 USAGE:
-    get-linked-data -i URL_CSV -s ELEMENT_SELECTOR -o OUTPUT_CSV -e FAILED_URL_CSV
+    get-linked-data -i URL_CSV -s ELEMENT_SELECTOR -o OUTPUT_FILE -e FAILED_URL_CSV
 
 ARGS:
 `
@@ -53,15 +56,55 @@ func main() {
 	}
 
 	// Define the Long CLI flag names
-	var inputCsvFile = flag.String("i", "", "CSV File containing URLs to Scrape  (Required)")
-	var elementSelector = flag.String("s", "", "Element Selector  (Required)")
+	var inputFile = flag.String("i", "", "File containing URLs to Scrape, or - to Read stdin, optionally gzip or zstd Compressed  (Required unless -sitemap)")
+	var inputFormat = flag.String("input-format", "", "Input File Format, either 'csv' for the first column, 'text' for a URL per line, or 'jsonl' for JSON Lines  (default from the File extension, otherwise csv)")
+	var urlField = flag.String("url-field", DEFAULT_URL_FIELD, "JSON Lines Field holding the URL, a dot separated path for a nested Field")
+	var urlColumn = flag.String("url-column", "", "CSV Column holding the URL, either its Header Row name or its 1-based index  (default the first column)")
+	var header = flag.Bool("header", false, "CSV Input File begins with a Header Row, which is Skipped, implied when -url-column is a name")
+	var passThrough = flag.Bool("pass-through", false, "Pass the other CSV Input Columns Through to the Output alongside each Record, named by the Header Row, otherwise column_N")
+	var stream = flag.Bool("stream", false, "Stream the URLs from the Input File into the Crawl as they are Read, rather than Loading and Shuffling them first")
+	var sitemapURLs SitemapURLs
+	flag.Var(&sitemapURLs, "sitemap", "Site Root or Sitemap URL, Scraping every Page listed by the Sitemaps and Sitemap Index Files, may be Repeated. A Site Root uses the Sitemaps listed by its robots.txt")
+	var sitemapMatch = flag.String("sitemap-match", "", "Regular Expression a Sitemap Page URL must Match to be Scraped")
+	var sitemapSince = flag.String("sitemap-since", "", "Only Scrape Sitemap Pages with a lastmod on or after this Date, as YYYY-MM-DD or RFC 3339")
+	var elementSelector = flag.String("s", "", "Element Selector  (Required unless -jsonld, -microdata, -rdfa or -meta)")
 	var jqSelector = flag.String("j", "", "jq Selector")
-	var outputCsvFile = flag.String("o", "", "Output Scraped Data CSV File  (Required)")
-	var errorCsvFile = flag.String("e", "", "Failed Request URLs Output CSV File  (Required)")
+	var jqDefinitionsFile = flag.String("jq-defs", "", "File containing jq Function Definitions available to the jq Selector")
+	var jqArgs JQArgs
+	flag.Var(&jqArgs, "jq-arg", "jq Variable provided as name=value, available to the jq Selector as $name, may be Repeated. $url always holds the Page URL")
+	var jqResults = flag.String("jq-results", JQ_RESULTS_FIRST, "jq Selector Results to Keep, either 'first', 'rows' for a Record per value, or 'array'")
+	var followDepth = flag.Int("follow-depth", 0, "Follow Links to Pages of the Allowed Domains up to this many Links away from each URL, 0 to not Follow Links")
+	var followInclude = flag.String("follow-include", "", "Regular Expression a Link must Match to be Followed")
+	var followExclude = flag.String("follow-exclude", "", "Regular Expression of Links never to Follow")
+	var outputFile = flag.String("o", "", "Output Scraped Data File  (Required)")
+	var outputFormat = flag.String("format", FORMAT_CSV, "Output Scraped Data File Format, either 'csv', 'jsonl' for JSON Lines, 'json' for a JSON Array, 'parquet', or 'sqlite' to Upsert into a Database")
+	var fieldsFile = flag.String("fields", "", "JSON File of Column Name to jq Expression, Flattening the Scraped Data into CSV Columns with a Header Row, or into additional Parquet Columns")
+	var rowGroupSize = flag.Int("row-group-size", DEFAULT_ROW_GROUP_SIZE, "Records per Parquet Row Group")
+	var errorCsvFile = flag.String("e", "", "Failed Request URLs Output CSV File  (Required unless -format sqlite, which stores the Failed Requests in the Database)")
+	var rejectCsvFile = flag.String("r", "", "Rejected Page URLs Output CSV File, listing Pages which Loaded yet Yielded no Records or had Records Rejected")
+	var checkpointFile = flag.String("checkpoint", "", "Checkpoint File recording the State of each URL as it Completes")
+	var resume = flag.Bool("resume", false, "Resume an Interrupted Crawl, Skipping URLs Completed in the Checkpoint File, Retrying Failed URLs and Appending to the Output Files")
+	var pendingCsvFile = flag.String("u", "", "Pending URLs Output CSV File, listing the URLs not yet Visited if the Crawl is Interrupted  (default OUTPUT_FILE.pending.csv)")
+	var shutdownTimeout = flag.Int("shutdown-timeout", DEFAULT_SHUTDOWN_TIMEOUT, "Maximum Wait in Milliseconds for In-Flight Requests once the Crawl is Interrupted")
 	var fieldDelimiter = flag.String("d", ",", "Field Delimiter  (Required)")
 	var parallelism = flag.Int("p", 100, "Parallelism or Maximum allowed Concurrent Requests")
 	var waitTime = flag.Int("w", 2000, "Random Wait Time in Milliseconds between Requests")
+	var domainParallelism = flag.Int("domain-parallelism", 0, "Maximum allowed Concurrent Requests to each Domain, 0 for no Limit other than -p")
+	var domainRPS = flag.Float64("domain-rps", 0, "Maximum Requests per Second to each Domain, 0 for no Limit")
+	var adaptive = flag.Bool("adaptive", false, "Adapt the Requests per Second to each Domain, Slowing on 429 or 503 Responses, Timeouts and Rising Latency, and Speeding back up to -domain-rps while Healthy")
+	var domainLimitsFile = flag.String("domain-limits", "", "JSON File of Domain glob to Concurrent Requests and Requests per Second, Overriding -domain-parallelism and -domain-rps")
+	var robotsPolicy = flag.String("robots", ROBOTS_IGNORE, "robots.txt Policy, either 'ignore' or 'obey' to Fetch the robots.txt of each Host, Skipping Disallowed URLs and Honouring any Crawl-delay")
+	var robotsAgent = flag.String("robots-agent", DEFAULT_ROBOTS_AGENT, "User Agent token Matched against the robots.txt Rules")
+	var maxAttempts = flag.Int("max-attempts", DEFAULT_MAX_ATTEMPTS, "Maximum Attempts for each Request, Retrying Transient Failures")
+	var retryStatusCodes = flag.String("retry-status", DEFAULT_RETRY_STATUS_CODES, "Comma Separated HTTP Status Codes to Retry, Timeouts and Connection Failures are always Retried")
+	var retryDelay = flag.Int("retry-delay", DEFAULT_RETRY_BASE_DELAY, "Base Retry Delay in Milliseconds, Doubled on each Attempt with Jitter unless a Retry-After header is sent")
+	var retryMaxDelay = flag.Int("retry-max-delay", DEFAULT_RETRY_MAX_DELAY, "Maximum Retry Delay in Milliseconds, including any Retry-After header")
 	var scrapeXML = flag.Bool("x", false, "Scrape XML not HTML")
+	var extractJSONLD = flag.Bool("jsonld", false, "Extract every JSON-LD Script Block, the Element Selector is then Optional")
+	var extractMicrodata = flag.Bool("microdata", false, "Extract every Microdata Item as JSON-LD, the Element Selector is then Optional")
+	var extractRDFa = flag.Bool("rdfa", false, "Extract every RDFa Resource as JSON-LD, the Element Selector is then Optional")
+	var extractMeta = flag.Bool("meta", false, "Extract the OpenGraph, Twitter Card, Canonical Link and Description Meta Tags, the Element Selector is then Optional")
+	var expandGraph = flag.Bool("expand-graph", false, "Expand JSON-LD @graph and top level Arrays into individual Records")
 	var scrapeGoogleWebCache = flag.Bool("g", false, "Scrape Google's Cached Version Instead")
 	var verbose = flag.Bool("v", false, "Output Verbose Detail")
 
@@ -69,7 +112,107 @@ func main() {
 	flag.Parse()
 
 	// Validate the Required Flags
-	if *inputCsvFile == "" || *elementSelector == "" || *outputCsvFile == "" || *errorCsvFile == "" {
+	if (*inputFile == "" && len(sitemapURLs) == 0) || *outputFile == "" || (*errorCsvFile == "" && *outputFormat != FORMAT_SQLITE) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate an Element Selector was provided unless natively extracting the Linked Data
+	if *elementSelector == "" && (*scrapeXML || !(*extractJSONLD || *extractMicrodata || *extractRDFa || *extractMeta)) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate the jq Results mode
+	if *jqResults != JQ_RESULTS_FIRST && *jqResults != JQ_RESULTS_ROWS && *jqResults != JQ_RESULTS_ARRAY {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate the Output Format
+	if *outputFormat != FORMAT_CSV && *outputFormat != FORMAT_JSONL && *outputFormat != FORMAT_JSON && *outputFormat != FORMAT_PARQUET && *outputFormat != FORMAT_SQLITE {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate the Fields are only provided for the Formats with Columns, and the Parquet Options
+	if *rowGroupSize < 1 || (*fieldsFile != "" && *outputFormat != FORMAT_CSV && *outputFormat != FORMAT_PARQUET) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate the Sitemap Filter
+	var sitemapFilter SitemapFilter
+	if *sitemapMatch != "" {
+		match, err := regexp.Compile(*sitemapMatch)
+		if err != nil {
+			flag.Usage()
+			os.Exit(1)
+		}
+		sitemapFilter.Match = match
+	}
+	if *sitemapSince != "" {
+		var ok bool
+		if sitemapFilter.Since, ok = parseSitemapTime(*sitemapSince); !ok {
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	// Validate the Follow Policy, Links are not Followed from Google's Cached Version
+	followPolicy := FollowPolicy{MaxDepth: *followDepth}
+	if *followDepth < 0 || (*followDepth > 0 && *scrapeGoogleWebCache) {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *followInclude != "" {
+		include, err := regexp.Compile(*followInclude)
+		if err != nil {
+			flag.Usage()
+			os.Exit(1)
+		}
+		followPolicy.Include = include
+	}
+	if *followExclude != "" {
+		exclude, err := regexp.Compile(*followExclude)
+		if err != nil {
+			flag.Usage()
+			os.Exit(1)
+		}
+		followPolicy.Exclude = exclude
+	}
+
+	// Validate the Retry Policy
+	statusCodes, err := ParseStatusCodes(*retryStatusCodes)
+	if err != nil || *maxAttempts < 1 || *retryDelay < 0 || *retryMaxDelay < *retryDelay {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate the Domain Limits and robots.txt Policy
+	if *domainParallelism < 0 || *domainRPS < 0 || (*robotsPolicy != ROBOTS_IGNORE && *robotsPolicy != ROBOTS_OBEY) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate the Shutdown Timeout, and default the Pending URLs Output File alongside the Output File
+	if *shutdownTimeout < 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *pendingCsvFile == "" {
+		*pendingCsvFile = *outputFile + ".pending.csv"
+	}
+
+	// Validate a Checkpoint File is provided when Resuming, the Output Format can be Appended to,
+	// and Links are not Followed, as Links discovered yet not Visited are not recorded in the Checkpoint File
+	if *resume && (*checkpointFile == "" || *outputFormat == FORMAT_PARQUET || *followDepth > 0) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate the Input Format, and that there is an Input File to Stream
+	if (*inputFormat != "" && *inputFormat != INPUT_CSV && *inputFormat != INPUT_TEXT && *inputFormat != INPUT_JSONL) || (*stream && *inputFile == "") {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -95,24 +238,168 @@ func main() {
 	// Output Header
 	logger.Info().Msgf(applicationText, filepath.Base(os.Args[0]), "")
 	logger.Info().Msg("Arguments")
-	logger.Info().Str("CSV File containing URLs to Scrape", *inputCsvFile).Msg(indent)
+	logger.Info().Str("File containing URLs to Scrape", *inputFile).Msg(indent)
+	logger.Info().Str("Input File Format", *inputFormat).Msg(indent)
+	logger.Info().Str("JSON Lines URL Field", *urlField).Msg(indent)
+	logger.Info().Str("CSV URL Column", *urlColumn).Msg(indent)
+	logger.Info().Bool("CSV Input File begins with a Header Row", *header).Msg(indent)
+	logger.Info().Bool("Pass the other CSV Input Columns Through", *passThrough).Msg(indent)
+	logger.Info().Bool("Stream the URLs from the Input File", *stream).Msg(indent)
+	logger.Info().Str("Sitemaps", sitemapURLs.String()).Msg(indent)
+	logger.Info().Str("Sitemap Page URL Regular Expression", *sitemapMatch).Msg(indent)
+	logger.Info().Str("Sitemap Pages Modified Since", *sitemapSince).Msg(indent)
 	logger.Info().Str("Element Selector", *elementSelector).Msg(indent)
 	logger.Info().Str("jq Selector", *jqSelector).Msg(indent)
-	logger.Info().Str("Output Scraped Data CSV File", *outputCsvFile).Msg(indent)
+	logger.Info().Str("jq Selector Results to Keep", *jqResults).Msg(indent)
+	logger.Info().Str("jq Function Definitions File", *jqDefinitionsFile).Msg(indent)
+	logger.Info().Str("jq Variables", jqArgs.String()).Msg(indent)
+	logger.Info().Int("Follow Links up to Depth", *followDepth).Msg(indent)
+	logger.Info().Str("Follow Links Matching", *followInclude).Msg(indent)
+	logger.Info().Str("Never Follow Links Matching", *followExclude).Msg(indent)
+	logger.Info().Str("Output Scraped Data File", *outputFile).Msg(indent)
+	logger.Info().Str("Output Scraped Data File Format", *outputFormat).Msg(indent)
+	logger.Info().Str("Fields File", *fieldsFile).Msg(indent)
+	logger.Info().Int("Records per Parquet Row Group", *rowGroupSize).Msg(indent)
 	logger.Info().Str("Failed Request URLs Output CSV File", *errorCsvFile).Msg(indent)
+	logger.Info().Str("Rejected Page URLs Output CSV File", *rejectCsvFile).Msg(indent)
+	logger.Info().Str("Checkpoint File", *checkpointFile).Msg(indent)
+	logger.Info().Bool("Resume an Interrupted Crawl", *resume).Msg(indent)
+	logger.Info().Str("Pending URLs Output CSV File", *pendingCsvFile).Msg(indent)
+	logger.Info().Int("Shutdown Timeout in Milliseconds", *shutdownTimeout).Msg(indent)
 	logger.Info().Str("Field Delimiter", *fieldDelimiter).Msg(indent)
 	logger.Info().Int("Parallelism or Maximum allowed Concurrent Requests", *parallelism).Msg(indent)
 	logger.Info().Int("Random Wait Time in Milliseconds between Requests", *waitTime).Msg(indent)
+	logger.Info().Int("Maximum allowed Concurrent Requests to each Domain", *domainParallelism).Msg(indent)
+	logger.Info().Float64("Maximum Requests per Second to each Domain", *domainRPS).Msg(indent)
+	logger.Info().Str("Domain Limits File", *domainLimitsFile).Msg(indent)
+	logger.Info().Bool("Adapt the Requests per Second to each Domain", *adaptive).Msg(indent)
+	logger.Info().Str("robots.txt Policy", *robotsPolicy).Msg(indent)
+	logger.Info().Str("robots.txt User Agent token", *robotsAgent).Msg(indent)
+	logger.Info().Int("Maximum Attempts for each Request", *maxAttempts).Msg(indent)
+	logger.Info().Str("HTTP Status Codes to Retry", *retryStatusCodes).Msg(indent)
+	logger.Info().Int("Base Retry Delay in Milliseconds", *retryDelay).Msg(indent)
+	logger.Info().Int("Maximum Retry Delay in Milliseconds", *retryMaxDelay).Msg(indent)
 	logger.Info().Bool("Scrape XML not HTML", *scrapeXML).Msg(indent)
+	logger.Info().Bool("Extract every JSON-LD Script Block", *extractJSONLD).Msg(indent)
+	logger.Info().Bool("Extract every Microdata Item", *extractMicrodata).Msg(indent)
+	logger.Info().Bool("Extract every RDFa Resource", *extractRDFa).Msg(indent)
+	logger.Info().Bool("Extract the Meta Tags", *extractMeta).Msg(indent)
+	logger.Info().Bool("Expand JSON-LD @graph and top level Arrays", *expandGraph).Msg(indent)
 	logger.Info().Bool("Scrape Google's Cached Version Instead", *scrapeGoogleWebCache).Msg(indent)
 	logger.Info().Msg("Begin")
 
-	// Load the URLs into memory ready for Colly to crawl & scrape the Linked Data
-	var crawler = NewCrawler(*elementSelector, *jqSelector, *waitTime, *parallelism)
-	if err := crawler.LoadUrlFile(*inputCsvFile, *fieldDelimiter); err != nil {
-		logger.Error().Err(err).Msg("Failed Loading URL List")
+	// Read the jq Function Definitions, if provided
+	var jqDefinitions string
+	if *jqDefinitionsFile != "" {
+		content, err := os.ReadFile(*jqDefinitionsFile)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed Reading jq Function Definitions File")
+			os.Exit(1)
+		}
+		jqDefinitions = string(content)
+	}
+
+	// Compile the jq Selector before any request is made
+	crawler, err := NewCrawler(*elementSelector, *jqSelector, jqDefinitions, jqArgs, *waitTime, *parallelism)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed Creating Crawler")
 		os.Exit(1)
 	}
+	// Compile the jq Path of each Field, if provided
+	var fields Fields
+	if *fieldsFile != "" {
+		fields, err = LoadFieldsFile(*fieldsFile, jqDefinitions, jqArgs)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed Loading Fields File")
+			os.Exit(1)
+		}
+	}
+
+	// Load the Domain Limits, if provided
+	var domainLimits []DomainLimit
+	if *domainLimitsFile != "" {
+		domainLimits, err = LoadDomainLimitsFile(*domainLimitsFile)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed Loading Domain Limits File")
+			os.Exit(1)
+		}
+	}
+
+	crawler.JQResults = *jqResults
+	crawler.Retry = RetryPolicy{
+		MaxAttempts: *maxAttempts,
+		StatusCodes: statusCodes,
+		BaseDelay:   time.Millisecond * time.Duration(*retryDelay),
+		MaxDelay:    time.Millisecond * time.Duration(*retryMaxDelay),
+	}
+	crawler.Limiter.DomainParallelism = *domainParallelism
+	crawler.Limiter.DomainRPS = *domainRPS
+	crawler.Limiter.DomainLimits = domainLimits
+	crawler.Limiter.Adaptive = *adaptive
+	crawler.Robots.Obey = *robotsPolicy == ROBOTS_OBEY
+	crawler.Robots.Agent = *robotsAgent
+	crawler.Follow = followPolicy
+	crawler.ShutdownTimeout = time.Millisecond * time.Duration(*shutdownTimeout)
+	crawler.ExtractJSONLD = *extractJSONLD
+	crawler.ExtractMicrodata = *extractMicrodata
+	crawler.ExtractRDFa = *extractRDFa
+	crawler.ExtractMeta = *extractMeta
+	crawler.ExpandGraph = *expandGraph
+
+	// Load the URLs into memory ready for Colly to crawl & scrape the Linked Data,
+	// or when Streaming, Open the Input File ready for the Crawler to Read
+	inputOptions := InputOptions{
+		Format:      *inputFormat,
+		Delimiter:   *fieldDelimiter,
+		URLField:    *urlField,
+		URLColumn:   *urlColumn,
+		Header:      *header,
+		PassThrough: *passThrough,
+	}
+	if *inputFile != "" && *stream {
+		crawler.Input, err = OpenURLReader(*inputFile, inputOptions)
+		if err != nil {
+			logger.Error().Err(err).Msg("Opening Input File Failed")
+			os.Exit(1)
+		}
+		crawler.InputColumns = crawler.Input.Columns()
+		crawler.InputLayout = crawler.Input.Layout()
+	} else if *inputFile != "" {
+		if err := crawler.LoadUrlFile(*inputFile, inputOptions); err != nil {
+			logger.Error().Err(err).Msg("Failed Loading URL List")
+			os.Exit(1)
+		}
+	}
+
+	// Load the URLs of the Pages listed by the Sitemaps, if provided
+	if len(sitemapURLs) > 0 {
+		if err := crawler.LoadSitemaps(sitemapURLs, sitemapFilter); err != nil {
+			logger.Error().Err(err).Msg("Failed Loading Sitemaps")
+			os.Exit(1)
+		}
+		if err := crawler.DeduplicateURLs(); err != nil {
+			logger.Error().Err(err).Msg("Failed to Deduplicate URL List")
+			os.Exit(1)
+		}
+	}
+
+	// Open the Checkpoint File, if provided, Skipping the URLs already Completed when Resuming
+	var checkpoint *Checkpoint
+	if *checkpointFile != "" {
+		checkpoint, err = OpenCheckpoint(*checkpointFile, *resume)
+		if err != nil {
+			logger.Error().Err(err).Msg("Opening Checkpoint File Failed")
+			os.Exit(1)
+		}
+
+		if *resume {
+			if err := crawler.SkipCompletedURLs(checkpoint); err != nil {
+				logger.Error().Err(err).Msg("Failed to Skip Completed URLs")
+				os.Exit(1)
+			}
+		}
+		crawler.Checkpoint = checkpoint
+	}
 
 	// Set the Allowed Domain List for the Colly Collector
 	if err := crawler.SetAllowedDomains(*scrapeGoogleWebCache); err != nil {
@@ -126,23 +413,94 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Execute the Colly Collector
-	if err := crawler.ExecuteScrape(*scrapeXML, *scrapeGoogleWebCache); err != nil {
-		logger.Error().Err(err).Msg("Scraping Linked Data Failed")
+	// Open the Scraped Data Output File, each record is written as it arrives
+	dataSink, err := NewDataSink(*outputFormat, *outputFile, SinkOptions{
+		Delimiter:    *fieldDelimiter,
+		Fields:       fields,
+		RowGroupSize: *rowGroupSize,
+		Append:       *resume,
+		Columns:      crawler.InputColumns,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("Opening Data File Failed")
 		os.Exit(1)
 	}
 
-	// Write the Scraped Data out to a File
-	if err := crawler.WriteDataFile(*outputCsvFile, *fieldDelimiter); err != nil {
+	// Open the Failed Request URLs Output File, each failure is written as it arrives,
+	// unless the Data Sink is a Database which also stores the Failed Requests
+	var errorSink ErrorSink
+	if databaseSink, ok := dataSink.(ErrorSink); ok && *errorCsvFile == "" {
+		errorSink = databaseSink
+	} else {
+		csvErrorSink, err := NewCSVErrorSink(*errorCsvFile, *fieldDelimiter, *resume)
+		if err != nil {
+			_ = dataSink.Close()
+			logger.Error().Err(err).Msg("Opening Error File Failed")
+			os.Exit(1)
+		}
+		errorSink = csvErrorSink
+	}
+
+	// Open the Rejected Page URLs Output File, if requested
+	var rejectSink RejectSink
+	if *rejectCsvFile != "" {
+		csvRejectSink, err := NewCSVRejectSink(*rejectCsvFile, *fieldDelimiter, *resume)
+		if err != nil {
+			_ = dataSink.Close()
+			_ = errorSink.Close()
+			logger.Error().Err(err).Msg("Opening Reject File Failed")
+			os.Exit(1)
+		}
+		rejectSink = csvRejectSink
+	}
+
+	// Stop the Crawl Gracefully on the first Interrupt or Terminate Signal, restoring
+	// the default behaviour so a second Signal Exits Immediately
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		crawler.Stop()
+	}()
+
+	// Execute the Colly Collector, then Close the Output Files whatever the outcome
+	scrapeErr := crawler.ExecuteScrape(dataSink, errorSink, rejectSink, *scrapeXML, *scrapeGoogleWebCache)
+	if crawler.Input != nil {
+		_ = crawler.Input.Close()
+	}
+	if err := dataSink.Close(); err != nil {
 		logger.Error().Err(err).Msg("Writing Data File Failed")
 		os.Exit(1)
 	}
-
-	// Write the Failed Request URLs out to a File
-	if err := crawler.WriteErrorFile(*errorCsvFile, *fieldDelimiter); err != nil {
+	if err := errorSink.Close(); err != nil {
 		logger.Error().Err(err).Msg("Writing Error File Failed")
 		os.Exit(1)
 	}
+	if rejectSink != nil {
+		if err := rejectSink.Close(); err != nil {
+			logger.Error().Err(err).Msg("Writing Reject File Failed")
+			os.Exit(1)
+		}
+	}
+	if checkpoint != nil {
+		if err := checkpoint.Close(); err != nil {
+			logger.Error().Err(err).Msg("Writing Checkpoint File Failed")
+			os.Exit(1)
+		}
+	}
+
+	// Write the URLs not yet Visited so the Crawl can be Continued later
+	if crawler.Stopped() {
+		if err := crawler.WritePendingFile(*pendingCsvFile, *fieldDelimiter); err != nil {
+			logger.Error().Err(err).Msg("Writing Pending File Failed")
+			os.Exit(1)
+		}
+	}
+	if scrapeErr != nil {
+		logger.Error().Err(scrapeErr).Msg("Scraping Linked Data Failed")
+		os.Exit(1)
+	}
 
 	logger.Info().Msg("Done!")
 }
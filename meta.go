@@ -0,0 +1,74 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Prefixes of the meta tag names collected from the document head
+var metaNamePrefixes = []string{"og:", "twitter:"}
+
+//---------------------------------------------------------------------------------------
+
+// Extract the OpenGraph and Twitter Card meta tags, the canonical link, the
+// description and the title of the document into a single JSON object, keyed
+// by the meta tag name. Repeated tags, such as og:image, become a list.
+func extractMeta(doc *goquery.Selection, base *url.URL) map[string]any {
+
+	item := make(map[string]any)
+
+	if title := doc.Find("title").First(); title.Length() > 0 {
+		item["title"] = strings.Join(strings.Fields(title.Text()), " ")
+	}
+
+	doc.Find("link[rel][href]").Each(func(_ int, s *goquery.Selection) {
+		for _, rel := range strings.Fields(s.AttrOr("rel", "")) {
+			if strings.EqualFold(rel, "canonical") {
+				item["canonical"] = resolveURL(base, s.AttrOr("href", ""))
+				return
+			}
+		}
+	})
+
+	// OpenGraph uses the property attribute, although many sites use name for both
+	doc.Find("meta[content]").Each(func(_ int, s *goquery.Selection) {
+		name := strings.ToLower(strings.TrimSpace(s.AttrOr("property", s.AttrOr("name", ""))))
+		if name == "" {
+			return
+		}
+		if name == "description" || hasAnyPrefix(name, metaNamePrefixes) {
+			addProperty(item, name, s.AttrOr("content", ""))
+		}
+	})
+
+	return item
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return true if the string begins with any of the prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
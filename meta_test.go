@@ -0,0 +1,54 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestExtractMeta(t *testing.T) {
+	html := `<html><head>
+<title>
+  Widget | Acme
+</title>
+<link rel="stylesheet" href="/style.css">
+<link rel="Canonical" href="/products/widget">
+<meta name="description" content="The best widget.">
+<meta name="viewport" content="width=device-width">
+<meta property="og:title" content="Widget">
+<meta property="og:image" content="https://example.com/a.jpg">
+<meta property="og:image" content="https://example.com/b.jpg">
+<meta name="twitter:card" content="summary">
+<meta name="Twitter:Site" content="@acme">
+</head><body><svg><title>Icon</title></svg></body></html>`
+
+	base, _ := url.Parse("https://example.com/products/widget?utm_source=feed")
+	item := extractMeta(parseTestDocument(t, html), base)
+
+	expected := `{"canonical":"https://example.com/products/widget","description":"The best widget.","og:image":["https://example.com/a.jpg","https://example.com/b.jpg"],"og:title":"Widget","title":"Widget | Acme","twitter:card":"summary","twitter:site":"@acme"}`
+	actual, _ := json.Marshal(item)
+	if string(actual) != expected {
+		t.Errorf("expected %s\ngot      %s", expected, actual)
+	}
+}
+
+func TestExtractMetaEmpty(t *testing.T) {
+	item := extractMeta(parseTestDocument(t, `<html><body><p>No metadata</p></body></html>`), nil)
+	if len(item) != 0 {
+		t.Errorf("expected no metadata, got %v", item)
+	}
+}
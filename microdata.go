@@ -0,0 +1,210 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Maximum depth of nested items, guarding against itemref cycles
+const MAX_ITEM_DEPTH = 16
+
+//---------------------------------------------------------------------------------------
+
+// Extract each top level Microdata item found within the document as a
+// JSON-LD shaped object, resolving relative URLs against the base URL
+func extractMicrodata(doc *goquery.Selection, base *url.URL) []any {
+
+	var items []any
+	doc.Find("[itemscope]").Not("[itemprop]").Each(func(_ int, s *goquery.Selection) {
+		items = append(items, microdataItem(doc, s, base, 0))
+	})
+
+	return items
+}
+
+//---------------------------------------------------------------------------------------
+
+// Convert the Microdata item scoped by the element into a JSON-LD shaped object
+func microdataItem(doc *goquery.Selection, s *goquery.Selection, base *url.URL, depth int) map[string]any {
+
+	item := make(map[string]any)
+
+	// The item type determines the vocabulary used to shorten the property names
+	vocabulary := ""
+	if itemTypes := strings.Fields(s.AttrOr("itemtype", "")); len(itemTypes) > 0 {
+		var types []string
+		for _, itemType := range itemTypes {
+			var term string
+			vocabulary, term = splitVocabulary(itemType)
+			types = append(types, term)
+		}
+		item["@context"] = strings.TrimSuffix(vocabulary, "/")
+		item["@type"] = singleOrList(types)
+	}
+	if itemID, ok := s.Attr("itemid"); ok {
+		item["@id"] = resolveURL(base, itemID)
+	}
+
+	// Properties are found within the item element, and any elements it references by id
+	roots := []*goquery.Selection{s.Children()}
+	for _, id := range strings.Fields(s.AttrOr("itemref", "")) {
+		roots = append(roots, doc.Find("[id]").FilterFunction(func(_ int, e *goquery.Selection) bool {
+			return e.AttrOr("id", "") == id
+		}).First())
+	}
+
+	for _, root := range roots {
+		walkProperties(root, "itemprop", "itemscope", func(p *goquery.Selection) {
+			var value any
+			if _, ok := p.Attr("itemscope"); ok {
+				if depth >= MAX_ITEM_DEPTH {
+					return
+				}
+				value = microdataItem(doc, p, base, depth+1)
+			} else {
+				value = propertyValue(p, base)
+			}
+			for _, name := range strings.Fields(p.AttrOr("itemprop", "")) {
+				addProperty(item, shortenTerm(name, vocabulary), value)
+			}
+		})
+	}
+
+	return item
+}
+
+//---------------------------------------------------------------------------------------
+
+// Call the function for every element carrying the property attribute,
+// without descending into any nested item as its properties are its own
+func walkProperties(s *goquery.Selection, propertyAttr string, scopeAttr string, fn func(p *goquery.Selection)) {
+
+	s.Each(func(_ int, child *goquery.Selection) {
+		if _, ok := child.Attr(propertyAttr); ok {
+			fn(child)
+		}
+		if _, ok := child.Attr(scopeAttr); ok {
+			return
+		}
+		walkProperties(child.Children(), propertyAttr, scopeAttr, fn)
+	})
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the value of a property element, which depends upon the element name
+func propertyValue(p *goquery.Selection, base *url.URL) string {
+
+	// Many sites place a machine readable value in the content attribute of any element
+	if content, ok := p.Attr("content"); ok {
+		return content
+	}
+
+	switch goquery.NodeName(p) {
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		return resolveURL(base, p.AttrOr("src", ""))
+	case "a", "area", "link":
+		return resolveURL(base, p.AttrOr("href", ""))
+	case "object":
+		return resolveURL(base, p.AttrOr("data", ""))
+	case "data", "meter":
+		return p.AttrOr("value", "")
+	case "time":
+		if datetime, ok := p.Attr("datetime"); ok {
+			return datetime
+		}
+	}
+
+	return strings.Join(strings.Fields(p.Text()), " ")
+}
+
+//---------------------------------------------------------------------------------------
+
+// Add the property value to the item, repeated properties become a list
+func addProperty(item map[string]any, name string, value any) {
+
+	switch existing := item[name].(type) {
+	case nil:
+		item[name] = value
+	case []any:
+		item[name] = append(existing, value)
+	default:
+		item[name] = []any{existing, value}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Split a type IRI into its vocabulary and term, e.g. https://schema.org/ and Product
+func splitVocabulary(iri string) (string, string) {
+
+	i := strings.LastIndexAny(iri, "/#")
+	if i < 0 {
+		return "", iri
+	}
+	return iri[:i+1], iri[i+1:]
+}
+
+//---------------------------------------------------------------------------------------
+
+// Shorten a property IRI to its term when it belongs to the vocabulary,
+// ignoring the scheme as schema.org is published under both http and https
+func shortenTerm(name string, vocabulary string) string {
+
+	withoutScheme := func(iri string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(iri, "https://"), "http://")
+	}
+
+	if vocabulary != "" && strings.HasPrefix(withoutScheme(name), withoutScheme(vocabulary)) {
+		return strings.TrimPrefix(withoutScheme(name), withoutScheme(vocabulary))
+	}
+	return name
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return a single value unchanged, or multiple values as a list
+func singleOrList(values []string) any {
+
+	if len(values) == 1 {
+		return values[0]
+	}
+
+	list := make([]any, 0, len(values))
+	for _, value := range values {
+		list = append(list, value)
+	}
+	return list
+}
+
+//---------------------------------------------------------------------------------------
+
+// Resolve a possibly relative URL against the base URL, returning it unchanged on failure
+func resolveURL(base *url.URL, ref string) string {
+
+	if base == nil || ref == "" {
+		return ref
+	}
+
+	resolved, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return resolved.String()
+}
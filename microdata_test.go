@@ -0,0 +1,82 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Parse the HTML into a document selection for the extractors
+func parseTestDocument(t *testing.T, html string) *goquery.Selection {
+	t.Helper()
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("failed parsing document: %v", err)
+	}
+	return doc.Selection
+}
+
+func TestExtractMicrodata(t *testing.T) {
+	html := `<html><body>
+<div itemscope itemtype="https://schema.org/Product" itemid="#product" itemref="brand">
+  <span itemprop="name">Widget
+    Deluxe</span>
+  <img itemprop="image" src="/widget.jpg">
+  <a itemprop="url" href="widget">Widget</a>
+  <meta itemprop="sku" content="W-1">
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <span itemprop="price" content="9.99">$9.99</span>
+    <time itemprop="validFrom" datetime="2024-01-01">New Year</time>
+  </div>
+  <span itemprop="color">Red</span>
+  <span itemprop="color">Blue</span>
+</div>
+<p id="brand"><span itemprop="brand">Acme</span></p>
+<div itemscope itemtype="https://schema.org/Organization"><span itemprop="name">Acme</span></div>
+</body></html>`
+
+	base, _ := url.Parse("https://example.com/products/")
+	items := extractMicrodata(parseTestDocument(t, html), base)
+
+	expected := []string{
+		`{"@context":"https://schema.org","@id":"https://example.com/products/#product","@type":"Product","brand":"Acme","color":["Red","Blue"],"image":"https://example.com/widget.jpg","name":"Widget Deluxe","offers":{"@context":"https://schema.org","@type":"Offer","price":"9.99","validFrom":"2024-01-01"},"sku":"W-1","url":"https://example.com/products/widget"}`,
+		`{"@context":"https://schema.org","@type":"Organization","name":"Acme"}`,
+	}
+	if len(items) != len(expected) {
+		t.Fatalf("expected %d items, got %d", len(expected), len(items))
+	}
+	for i, item := range items {
+		actual, _ := json.Marshal(item)
+		if string(actual) != expected[i] {
+			t.Errorf("item %d:\nexpected %s\ngot      %s", i, expected[i], actual)
+		}
+	}
+}
+
+func TestExtractMicrodataItemrefCycle(t *testing.T) {
+	html := `<div id="a" itemscope itemtype="https://schema.org/Thing" itemref="b"></div>
+<div id="b" itemprop="related" itemscope itemref="b"></div>`
+
+	items := extractMicrodata(parseTestDocument(t, html), nil)
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gocolly/colly"
+)
+
+// Reasons a Page which loaded successfully yielded fewer Records than expected
+const REJECT_NO_MATCH = "no_match"
+const REJECT_INVALID_JSON = "invalid_json"
+const REJECT_JQ_ERROR = "jq_error"
+const REJECT_NO_VALUE = "no_value"
+
+// Outcome of Scraping a Page, held in the Request Context while the Collector
+// callbacks for the response run, which they do sequentially
+type pageOutcome struct {
+	records  int
+	rejected int
+	reason   string
+	err      string
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Outcome of Scraping the Page of the response
+func pageOutcomeOf(r *colly.Response) *pageOutcome {
+
+	if outcome, ok := r.Ctx.GetAny(PAGE_OUTCOME).(*pageOutcome); ok {
+		return outcome
+	}
+
+	// Scraping without an Outcome in the Request Context, so it is discarded
+	return &pageOutcome{}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Count an Element or JSON value rejected, keeping the first reason and error
+func (o *pageOutcome) reject(reason string, err error) {
+
+	o.rejected++
+	if o.reason == "" {
+		o.reason = reason
+		if err != nil {
+			o.err = err.Error()
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Rejected Page to report, if the Page yielded no Records or had any Rejected
+func (o *pageOutcome) rejectedPage(r *colly.Response) (RejectedPage, bool) {
+
+	if o.records > 0 && o.rejected == 0 {
+		return RejectedPage{}, false
+	}
+
+	reason := o.reason
+	if reason == "" {
+		reason = REJECT_NO_MATCH
+	}
+
+	return RejectedPage{
+		OriginalURL: r.Request.Ctx.Get(ORIGINAL_URL),
+		FinalURL:    r.Request.URL.String(),
+		StatusCode:  r.StatusCode,
+		Records:     o.records,
+		Rejected:    o.rejected,
+		Reason:      reason,
+		Error:       o.err,
+	}, true
+}
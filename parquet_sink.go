@@ -0,0 +1,226 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Default number of Scraped Records written per Parquet Row Group
+const DEFAULT_ROW_GROUP_SIZE = 10000
+
+// Typed Parquet columns written for every Scraped Record, ahead of any Fields
+var parquetColumns = []string{
+	"name=url, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED",
+	"name=final_url, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED",
+	"name=status_code, type=INT32, repetitiontype=REQUIRED",
+	"name=fetched_at, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=REQUIRED",
+	"name=element_index, type=INT32, repetitiontype=REQUIRED",
+	"name=type, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL",
+	"name=syntax, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED",
+	"name=data, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED",
+}
+
+var parquetNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var parquetInvalidPattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Data Sink writing each Scraped Record as a row in a Parquet File, along with
+// a column per Field flattened from the JSON Data and a column per Input File
+// Column Passed Through. Rows are buffered in memory and written to the File
+// a Row Group at a time.
+type ParquetDataSink struct {
+	file         source.ParquetFile
+	writer       *writer.JSONWriter
+	fields       Fields
+	columns      map[string]string
+	rowGroupSize int
+	rows         int
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a Parquet Data Sink writing to the named File
+func NewParquetDataSink(name string, fields Fields, columns []string, rowGroupSize int) (*ParquetDataSink, error) {
+
+	if rowGroupSize <= 0 {
+		rowGroupSize = DEFAULT_ROW_GROUP_SIZE
+	}
+
+	schema, names, err := parquetSchema(fields, columns)
+	if err != nil {
+		return nil, fmt.Errorf("[NewParquetDataSink] %w", err)
+	}
+
+	// Open file ready for writing
+	file, err := local.NewLocalFileWriter(name)
+	if err != nil {
+		return nil, fmt.Errorf("[NewParquetDataSink] Create File Failed: %w", err)
+	}
+
+	w, err := writer.NewJSONWriter(schema, file, 1)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("[NewParquetDataSink] Parquet Writer Failed: %w", err)
+	}
+	w.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	return &ParquetDataSink{file: file, writer: w, fields: fields, columns: names, rowGroupSize: rowGroupSize}, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the JSON Schema of the Parquet File, Fields and Columns are written as
+// optional strings so a jq path selecting nothing is stored as null. The Parquet
+// column name of each Input Column is returned, keyed by the Input Column name.
+func parquetSchema(fields Fields, columns []string) (string, map[string]string, error) {
+
+	reserved := make(map[string]bool)
+	tags := make([]string, 0, len(parquetColumns)+len(fields))
+	for _, column := range parquetColumns {
+		reserved[strings.TrimPrefix(strings.Split(column, ",")[0], "name=")] = true
+		tags = append(tags, column)
+	}
+
+	for _, field := range fields {
+		if !parquetNamePattern.MatchString(field.Name) {
+			return "", nil, fmt.Errorf("Field name is not a valid Parquet column name: %s", field.Name)
+		}
+		if reserved[field.Name] {
+			return "", nil, fmt.Errorf("Field name is Reserved: %s", field.Name)
+		}
+		tags = append(tags, fmt.Sprintf("name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL", field.Name))
+	}
+	for _, field := range fields {
+		reserved[field.Name] = true
+	}
+
+	// Input Columns are named by the Header Row, so are Sanitised rather than Rejected
+	names := make(map[string]string, len(columns))
+	for _, column := range columns {
+		name := parquetColumnName(column)
+		if reserved[name] {
+			return "", nil, fmt.Errorf("Input Column name is Reserved, a Field name or a Duplicate once Sanitised: %s (%s)", column, name)
+		}
+		reserved[name] = true
+		names[column] = name
+		tags = append(tags, fmt.Sprintf("name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL", name))
+	}
+
+	var schemaFields []map[string]string
+	for _, tag := range tags {
+		schemaFields = append(schemaFields, map[string]string{"Tag": tag})
+	}
+	schema, err := json.Marshal(map[string]any{
+		"Tag":    "name=parquet_go_root, repetitiontype=REQUIRED",
+		"Fields": schemaFields,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("Parquet Schema Marshal Failed: %w", err)
+	}
+
+	return string(schema), names, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return a valid Parquet column name for the Input Column, replacing each character
+// other than a letter, digit or underscore with an underscore, and prefixing a name
+// starting with a digit, or empty, with an underscore
+func parquetColumnName(column string) string {
+
+	name := parquetInvalidPattern.ReplaceAllString(strings.TrimSpace(column), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+
+	return name
+}
+
+//---------------------------------------------------------------------------------------
+
+// Add the Scraped Record to the current Row Group, writing the Row Group to
+// the File once it is full. A Field which fails to select is written as null.
+func (s *ParquetDataSink) WriteRecord(record ScrapedRecord) error {
+
+	values, err := s.fields.Select(record)
+	if err != nil {
+		logger.Error().Err(err).Str("Visited", record.OriginalURL).Msg(doubleIndent)
+	}
+
+	row := map[string]any{
+		"url":           record.OriginalURL,
+		"final_url":     record.FinalURL,
+		"status_code":   record.StatusCode,
+		"fetched_at":    record.FetchedAt.UnixMilli(),
+		"element_index": record.ElementIndex,
+		"syntax":        record.Syntax,
+		"data":          record.Data,
+	}
+	if record.Type != "" {
+		row["type"] = record.Type
+	}
+	for i, field := range s.fields {
+		if values[i] != nil {
+			row[field.Name] = *values[i]
+		}
+	}
+	for _, column := range record.Input {
+		if name, ok := s.columns[column.Name]; ok {
+			row[name] = column.Value
+		}
+	}
+
+	rowJSON, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("[WriteRecord] JSON Marshal Failed: %w", err)
+	}
+	if err := s.writer.Write(string(rowJSON)); err != nil {
+		return fmt.Errorf("[WriteRecord] Failed Writing the Row: %w", err)
+	}
+
+	s.rows++
+	if s.rows%s.rowGroupSize == 0 {
+		if err := s.writer.Flush(true); err != nil {
+			return fmt.Errorf("[WriteRecord] Failed Writing the Row Group: %w", err)
+		}
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Write the final Row Group and the File Footer, then Close the Parquet File
+func (s *ParquetDataSink) Close() error {
+
+	if err := s.writer.WriteStop(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("[Close] Failed Writing the File Footer: %w", err)
+	}
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("[Close] Failed Closing the File: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParquetDataSink(t *testing.T) {
+	fields, err := LoadFieldsFile(writeTestFile(t, "fields.json", `{"sku": ".sku", "price": ".offers.price"}`), "", nil)
+	if err != nil {
+		t.Fatalf("LoadFieldsFile failed: %v", err)
+	}
+
+	name := filepath.Join(t.TempDir(), "results.parquet")
+	sink, err := NewParquetDataSink(name, fields, []string{"Product Category"}, 2)
+	if err != nil {
+		t.Fatalf("NewParquetDataSink failed: %v", err)
+	}
+
+	fetchedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []ScrapedRecord{
+		{OriginalURL: "https://example.com/a", FinalURL: "https://example.com/a", StatusCode: 200, FetchedAt: fetchedAt, Type: "Product", Syntax: SYNTAX_JSONLD, Data: `{"sku": "A", "offers": {"price": 1.5}}`, Input: InputColumns{{Name: "Product Category", Value: "shoes"}}},
+		{OriginalURL: "https://example.com/b", FinalURL: "https://example.com/b", StatusCode: 200, FetchedAt: fetchedAt, ElementIndex: 1, Syntax: SYNTAX_JSONLD, Data: `{"sku": "B"}`},
+		{OriginalURL: "https://example.com/c", FinalURL: "https://example.com/c", StatusCode: 200, FetchedAt: fetchedAt, Syntax: SYNTAX_ELEMENT, Data: "plain text"},
+	}
+	for _, record := range records {
+		if err := sink.WriteRecord(record); err != nil {
+			t.Fatalf("WriteRecord failed: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Read the File back, checking the Row Groups and the typed and flattened columns
+	file, err := local.NewLocalFileReader(name)
+	if err != nil {
+		t.Fatalf("NewLocalFileReader failed: %v", err)
+	}
+	defer file.Close()
+
+	pr, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		t.Fatalf("NewParquetReader failed: %v", err)
+	}
+	defer pr.ReadStop()
+
+	if groups := len(pr.Footer.RowGroups); groups != 2 {
+		t.Errorf("expected 2 row groups, got %d", groups)
+	}
+	if rows := pr.GetNumRows(); rows != int64(len(records)) {
+		t.Fatalf("expected %d rows, got %d", len(records), rows)
+	}
+
+	rows, err := pr.ReadByNumber(len(records))
+	if err != nil {
+		t.Fatalf("ReadByNumber failed: %v", err)
+	}
+	actual, _ := json.Marshal(rows)
+	expected := `[` +
+		`{"Url":"https://example.com/a","Final_url":"https://example.com/a","Status_code":200,"Fetched_at":1704164645000,"Element_index":0,"Type":"Product","Syntax":"json-ld","Data":"{\"sku\": \"A\", \"offers\": {\"price\": 1.5}}","Sku":"A","Price":"1.5","Product_Category":"shoes"},` +
+		`{"Url":"https://example.com/b","Final_url":"https://example.com/b","Status_code":200,"Fetched_at":1704164645000,"Element_index":1,"Type":null,"Syntax":"json-ld","Data":"{\"sku\": \"B\"}","Sku":"B","Price":null,"Product_Category":null},` +
+		`{"Url":"https://example.com/c","Final_url":"https://example.com/c","Status_code":200,"Fetched_at":1704164645000,"Element_index":0,"Type":null,"Syntax":"element","Data":"plain text","Sku":null,"Price":null,"Product_Category":null}` +
+		`]`
+	if string(actual) != expected {
+		t.Errorf("expected %s\ngot      %s", expected, actual)
+	}
+}
+
+func TestParquetSchemaRejectsInvalidFieldNames(t *testing.T) {
+	for _, name := range []string{"url", "unit price", "price,type=INT32"} {
+		if _, _, err := parquetSchema(Fields{{Name: name}}, nil); err == nil {
+			t.Errorf("expected field name %q to be rejected", name)
+		}
+	}
+	for _, columns := range [][]string{{"final_url"}, {"sku"}, {" final url "}, {"SKU Code", "SKU-Code"}} {
+		if _, _, err := parquetSchema(Fields{{Name: "sku"}}, columns); err == nil {
+			t.Errorf("expected column names %q to be rejected", columns)
+		}
+	}
+}
+
+func TestParquetSchemaSanitisesColumnNames(t *testing.T) {
+	_, names, err := parquetSchema(nil, []string{"Product SKU", "sku-code", "1st", "", "prix €"})
+	if err != nil {
+		t.Fatalf("parquetSchema failed: %v", err)
+	}
+	expected := map[string]string{"Product SKU": "Product_SKU", "sku-code": "sku_code", "1st": "_1st", "": "_", "prix €": "prix__"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Prefixes predefined by the RDFa Initial Context, which pages commonly rely upon
+var rdfaInitialPrefixes = map[string]string{
+	"schema": "http://schema.org/",
+	"og":     "http://ogp.me/ns#",
+	"dc":     "http://purl.org/dc/terms/",
+	"foaf":   "http://xmlns.com/foaf/0.1/",
+	"rdfs":   "http://www.w3.org/2000/01/rdf-schema#",
+	"xsd":    "http://www.w3.org/2001/XMLSchema#",
+}
+
+//---------------------------------------------------------------------------------------
+
+// Extract each top level RDFa Lite resource found within the document as a
+// JSON-LD shaped object, resolving relative URLs against the base URL
+func extractRDFa(doc *goquery.Selection, base *url.URL) []any {
+
+	var items []any
+	doc.Find("[typeof]").Not("[property]").Each(func(_ int, s *goquery.Selection) {
+		items = append(items, rdfaItem(s, base, 0))
+	})
+
+	return items
+}
+
+//---------------------------------------------------------------------------------------
+
+// Convert the RDFa resource typed by the element into a JSON-LD shaped object
+func rdfaItem(s *goquery.Selection, base *url.URL, depth int) map[string]any {
+
+	item := make(map[string]any)
+
+	// The vocabulary in scope is used to shorten the type and property names
+	vocabulary := s.Closest("[vocab]").AttrOr("vocab", "")
+	prefixes := rdfaPrefixes(s)
+
+	var types []string
+	for _, typeOf := range strings.Fields(s.AttrOr("typeof", "")) {
+		typeIRI := expandRDFaTerm(typeOf, vocabulary, prefixes)
+		if vocabulary == "" {
+			vocabulary, _ = splitVocabulary(typeIRI)
+		}
+		types = append(types, shortenTerm(typeIRI, vocabulary))
+	}
+	if vocabulary != "" {
+		item["@context"] = strings.TrimSuffix(vocabulary, "/")
+	}
+	if len(types) > 0 {
+		item["@type"] = singleOrList(types)
+	}
+	if resource, ok := s.Attr("resource"); ok {
+		item["@id"] = resolveURL(base, resource)
+	} else if about, ok := s.Attr("about"); ok {
+		item["@id"] = resolveURL(base, about)
+	}
+
+	walkProperties(s.Children(), "property", "typeof", func(p *goquery.Selection) {
+		var value any
+		if _, ok := p.Attr("typeof"); ok {
+			if depth >= MAX_ITEM_DEPTH {
+				return
+			}
+			value = rdfaItem(p, base, depth+1)
+		} else if resource, ok := p.Attr("resource"); ok {
+			value = resolveURL(base, resource)
+		} else {
+			value = propertyValue(p, base)
+		}
+		for _, name := range strings.Fields(p.AttrOr("property", "")) {
+			addProperty(item, shortenTerm(expandRDFaTerm(name, vocabulary, prefixes), vocabulary), value)
+		}
+	})
+
+	return item
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the prefix mappings in scope for the element, declared on the
+// element itself or any ancestor, falling back to the initial context
+func rdfaPrefixes(s *goquery.Selection) map[string]string {
+
+	prefixes := make(map[string]string)
+	for prefix, iri := range rdfaInitialPrefixes {
+		prefixes[prefix] = iri
+	}
+
+	// Ancestors are returned nearest first, so apply the outermost declarations
+	// first and the element itself last, letting nearer declarations take precedence
+	declare := func(e *goquery.Selection) {
+		fields := strings.Fields(e.AttrOr("prefix", ""))
+		for j := 0; j+1 < len(fields); j += 2 {
+			prefixes[strings.TrimSuffix(fields[j], ":")] = fields[j+1]
+		}
+	}
+	ancestors := s.ParentsFiltered("[prefix]")
+	for i := ancestors.Length() - 1; i >= 0; i-- {
+		declare(ancestors.Eq(i))
+	}
+	declare(s)
+
+	return prefixes
+}
+
+//---------------------------------------------------------------------------------------
+
+// Expand an RDFa term, compact IRI or absolute IRI to an absolute IRI
+func expandRDFaTerm(term string, vocabulary string, prefixes map[string]string) string {
+
+	if prefix, reference, ok := strings.Cut(term, ":"); ok {
+		if iri, ok := prefixes[prefix]; ok {
+			return iri + reference
+		}
+		return term
+	}
+
+	return vocabulary + term
+}
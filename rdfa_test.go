@@ -0,0 +1,66 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestExtractRDFa(t *testing.T) {
+	html := `<html><body vocab="https://schema.org/">
+<div typeof="Product" resource="#product">
+  <span property="name">Widget</span>
+  <img property="image" src="/widget.jpg">
+  <link property="availability" href="https://schema.org/InStock">
+  <div property="offers" typeof="Offer">
+    <meta property="price" content="9.99">
+  </div>
+</div>
+</body></html>`
+
+	base, _ := url.Parse("https://example.com/products/")
+	items := extractRDFa(parseTestDocument(t, html), base)
+
+	expected := `{"@context":"https://schema.org","@id":"https://example.com/products/#product","@type":"Product","availability":"https://schema.org/InStock","image":"https://example.com/widget.jpg","name":"Widget","offers":{"@context":"https://schema.org","@type":"Offer","price":"9.99"}}`
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+	actual, _ := json.Marshal(items[0])
+	if string(actual) != expected {
+		t.Errorf("expected %s\ngot      %s", expected, actual)
+	}
+}
+
+func TestExtractRDFaPrefixes(t *testing.T) {
+	html := `<div prefix="ex: http://example.org/outer/">
+  <div prefix="ex: http://example.org/inner/" typeof="schema:Person">
+    <span property="schema:name">Ada</span>
+    <span property="ex:role">Engineer</span>
+  </div>
+</div>`
+
+	items := extractRDFa(parseTestDocument(t, html), nil)
+
+	expected := `{"@context":"http://schema.org","@type":"Person","http://example.org/inner/role":"Engineer","name":"Ada"}`
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+	actual, _ := json.Marshal(items[0])
+	if string(actual) != expected {
+		t.Errorf("expected %s\ngot      %s", expected, actual)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+)
+
+// Concurrency Safe in memory Data, Error and Reject Sink used by the tests, holding
+// the Scraped Data, Failed Requests and Rejected Pages until they are retrieved
+type ResultStore struct {
+	lock           sync.Mutex
+	scrapedData    []ScrapedRecord
+	failedRequests []FailedRequest
+	rejectedPages  []RejectedPage
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of an empty Result Store
+func NewResultStore() *ResultStore {
+	return &ResultStore{
+		scrapedData:    make([]ScrapedRecord, 0),
+		failedRequests: make([]FailedRequest, 0),
+		rejectedPages:  make([]RejectedPage, 0),
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Append a Scraped Record to the Result Store
+func (s *ResultStore) WriteRecord(record ScrapedRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.scrapedData = append(s.scrapedData, record)
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Append a Failed Request to the Result Store
+func (s *ResultStore) WriteFailure(failure FailedRequest) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failedRequests = append(s.failedRequests, failure)
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Append a Rejected Page to the Result Store
+func (s *ResultStore) WriteRejected(page RejectedPage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rejectedPages = append(s.rejectedPages, page)
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Nothing to release for an in memory Result Store
+func (s *ResultStore) Close() error {
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return a copy of the Scraped Data held in the Result Store
+func (s *ResultStore) ScrapedData() []ScrapedRecord {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]ScrapedRecord(nil), s.scrapedData...)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return a copy of the Failed Requests held in the Result Store
+func (s *ResultStore) FailedRequests() []FailedRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]FailedRequest(nil), s.failedRequests...)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return a copy of the Rejected Pages held in the Result Store
+func (s *ResultStore) RejectedPages() []RejectedPage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]RejectedPage(nil), s.rejectedPages...)
+}
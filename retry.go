@@ -0,0 +1,144 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default Retry Policy, retrying rate limited, unavailable and timed out requests
+const DEFAULT_MAX_ATTEMPTS = 3
+const DEFAULT_RETRY_STATUS_CODES = "429,500,502,503,504"
+const DEFAULT_RETRY_BASE_DELAY = 1000
+const DEFAULT_RETRY_MAX_DELAY = 30000
+
+// Policy deciding whether a Failed Request is Retried and how long to wait beforehand
+type RetryPolicy struct {
+	MaxAttempts int
+	StatusCodes []int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Default Retry Policy
+func DefaultRetryPolicy() RetryPolicy {
+
+	statusCodes, _ := ParseStatusCodes(DEFAULT_RETRY_STATUS_CODES)
+	return RetryPolicy{
+		MaxAttempts: DEFAULT_MAX_ATTEMPTS,
+		StatusCodes: statusCodes,
+		BaseDelay:   time.Millisecond * DEFAULT_RETRY_BASE_DELAY,
+		MaxDelay:    time.Millisecond * DEFAULT_RETRY_MAX_DELAY,
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Parse a comma separated list of HTTP status codes
+func ParseStatusCodes(text string) ([]int, error) {
+
+	var statusCodes []int
+	for _, field := range strings.Split(text, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		statusCode, err := strconv.Atoi(field)
+		if err != nil || statusCode < 100 || statusCode > 599 {
+			return nil, fmt.Errorf("Invalid HTTP Status Code: %s", field)
+		}
+		statusCodes = append(statusCodes, statusCode)
+	}
+
+	return statusCodes, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return true if a request which has been attempted the given number of times
+// should be Retried, either as its status code, or that of the robots.txt File
+// of the Host, is retryable, or no response was received as the request timed
+// out or the connection failed
+func (p RetryPolicy) shouldRetry(attempts int, statusCode int, err error) bool {
+
+	if attempts >= p.MaxAttempts {
+		return false
+	}
+
+	if statusCode = failureStatusCode(statusCode, err); statusCode != 0 {
+		return slices.Contains(p.StatusCodes, statusCode)
+	}
+
+	category := classifyFailure(statusCode, err)
+	return category == FAILURE_TIMEOUT || category == FAILURE_CONNECTION
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return how long to wait before the next attempt, honouring any Retry-After
+// header of the response, otherwise backing off exponentially with jitter.
+// The wait never exceeds the Maximum Delay.
+func (p RetryPolicy) delay(attempts int, headers *http.Header) time.Duration {
+
+	if headers != nil {
+		if retryAfter, ok := parseRetryAfter(headers.Get("Retry-After"), time.Now()); ok {
+			return min(retryAfter, p.MaxDelay)
+		}
+	}
+
+	// Double the delay on each attempt, then wait between half and all of it
+	backoff := p.BaseDelay
+	for i := 1; i < attempts && backoff < p.MaxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, p.MaxDelay)
+	if backoff <= 0 {
+		return 0
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+//---------------------------------------------------------------------------------------
+
+// Parse a Retry-After header, given either as a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
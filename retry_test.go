@@ -0,0 +1,208 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	statusCodes, err := ParseStatusCodes(" 429, 503,,")
+	if err != nil || fmt.Sprint(statusCodes) != "[429 503]" {
+		t.Errorf("expected [429 503], got %v, %v", statusCodes, err)
+	}
+	for _, text := range []string{"abc", "99", "600"} {
+		if _, err := ParseStatusCodes(text); err == nil {
+			t.Errorf("expected %q to be rejected", text)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	tests := []struct {
+		name       string
+		attempts   int
+		statusCode int
+		err        error
+		expected   bool
+	}{
+		{"rate limited", 1, 429, errors.New("Too Many Requests"), true},
+		{"unavailable", 2, 503, errors.New("Service Unavailable"), true},
+		{"attempts exhausted", 3, 503, errors.New("Service Unavailable"), false},
+		{"not found", 1, 404, errors.New("Not Found"), false},
+		{"timeout", 1, 0, context.DeadlineExceeded, true},
+		{"disallowed", 1, 0, errors.New("Forbidden domain"), false},
+		{"robots unavailable", 1, 0, &RobotsStatusError{StatusCode: 503}, true},
+		{"robots disallowed", 1, 0, ErrRobotsDisallowed, false},
+	}
+	for _, test := range tests {
+		if actual := policy.shouldRetry(test.attempts, test.statusCode, test.err); actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	// The exponential backoff doubles with each attempt, jittered between half and all of it
+	for attempts, backoff := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		for i := 0; i < 20; i++ {
+			if delay := policy.delay(attempts, nil); delay < backoff/2 || delay > backoff {
+				t.Errorf("attempt %d: delay %v is outside %v to %v", attempts, delay, backoff/2, backoff)
+			}
+		}
+	}
+
+	// A Retry-After header is honoured, up to the Maximum Delay
+	headers := http.Header{}
+	headers.Set("Retry-After", "3")
+	if delay := policy.delay(1, &headers); delay != 3*time.Second {
+		t.Errorf("expected the Retry-After delay of 3s, got %v", delay)
+	}
+	headers.Set("Retry-After", "120")
+	if delay := policy.delay(1, &headers); delay != 5*time.Second {
+		t.Errorf("expected the Retry-After delay to be capped at 5s, got %v", delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"30", 30 * time.Second, true},
+		{"Tue, 02 Jan 2024 03:05:05 GMT", time.Minute, true},
+		{"Tue, 02 Jan 2024 03:00:00 GMT", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		actual, ok := parseRetryAfter(test.value, now)
+		if actual != test.expected || ok != test.ok {
+			t.Errorf("%q: expected %v, %v, got %v, %v", test.value, test.expected, test.ok, actual, ok)
+		}
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeRetriesTransientFailures(t *testing.T) {
+	var lock sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		count := requests[r.URL.Path]
+		lock.Unlock()
+
+		// The flaky page is rate limited twice before succeeding, the down page never succeeds
+		if r.URL.Path == "/down" || count <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><script type="application/ld+json">{"@type": "Product"}</script></head></html>`)
+	}))
+	t.Cleanup(server.Close)
+
+	crawler, err := NewCrawler("", "", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.Retry.BaseDelay = time.Millisecond
+	crawler.Retry.MaxDelay = 10 * time.Millisecond
+	crawler.URLs = []string{server.URL + "/flaky", server.URL + "/down"}
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, nil, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	if scraped := results.ScrapedData(); len(scraped) != 1 || scraped[0].OriginalURL != server.URL+"/flaky" {
+		t.Errorf("expected the flaky page to be scraped once retried, got %+v", scraped)
+	}
+
+	failed := results.FailedRequests()
+	if len(failed) != 1 {
+		t.Fatalf("expected 1 failed request, got %+v", failed)
+	}
+	if failed[0].OriginalURL != server.URL+"/down" || failed[0].Attempts != DEFAULT_MAX_ATTEMPTS || failed[0].Category != FAILURE_RATE_LIMITED {
+		t.Errorf("unexpected failed request %+v", failed[0])
+	}
+	if requests["/down"] != DEFAULT_MAX_ATTEMPTS {
+		t.Errorf("expected %d requests for the down page, got %d", DEFAULT_MAX_ATTEMPTS, requests["/down"])
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeStopDuringRetryDelay(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	crawler, err := NewCrawler("", "", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.Retry.MaxDelay = time.Minute
+	crawler.URLs = []string{server.URL + "/unavailable"}
+
+	// Stop once the page has been requested, while backing off before the Retry
+	go func() {
+		<-requested
+		time.Sleep(50 * time.Millisecond)
+		crawler.Stop()
+	}()
+
+	started := time.Now()
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, nil, false, false); !errors.Is(err, ErrShutdown) {
+		t.Fatalf("expected ErrShutdown, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected the Retry delay to be cut short, took %v", elapsed)
+	}
+
+	// The page is neither Retried nor reported as Failed, so is left Pending
+	if failed := results.FailedRequests(); len(failed) != 0 {
+		t.Errorf("expected no failed requests, got %+v", failed)
+	}
+	if pending := crawler.PendingURLs(); len(pending) != 1 || pending[0] != crawler.URLs[0] {
+		t.Errorf("expected %v pending, got %v", crawler.URLs, pending)
+	}
+}
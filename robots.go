@@ -0,0 +1,197 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// Policies towards the robots.txt File of each Host
+const ROBOTS_IGNORE = "ignore"
+const ROBOTS_OBEY = "obey"
+
+// Default User Agent token matched against the robots.txt rules
+const DEFAULT_ROBOTS_AGENT = "get-linked-data"
+
+// Default time in milliseconds a robots.txt File which could not be fetched is
+// treated as Unavailable, before it is fetched again
+const DEFAULT_ROBOTS_RETRY_AFTER = 1000
+
+// Error returned for each Request Disallowed by the robots.txt File of its Host
+var ErrRobotsDisallowed = errors.New("URL Disallowed by robots.txt")
+
+// Error returned for each Request while the robots.txt File of its Host returns a Server Error
+type RobotsStatusError struct {
+	StatusCode int
+}
+
+// Fetches and caches the robots.txt File of each Host, when Obeyed, Disallowing
+// the Requests its rules for the User Agent token do not allow. A robots.txt File
+// which could not be fetched is fetched again once the Retry After time has passed.
+type RobotsPolicy struct {
+	Obey       bool
+	Agent      string
+	RetryAfter time.Duration
+	client     *http.Client
+	lock       sync.Mutex
+	hosts      map[string]*robotsEntry
+}
+
+// robots.txt File of a single Host, fetched on first use, or the error fetching
+// it until it Expires
+type robotsEntry struct {
+	lock    sync.Mutex
+	data    *robotstxt.RobotsData
+	group   *robotstxt.Group
+	err     error
+	expires time.Time
+}
+
+// HTTP Transport checking the robots.txt File of the Host before each Request is
+// made, and applying any Crawl-delay to the Request Limiter of the Domain
+type robotsTransport struct {
+	http.RoundTripper
+	robots  *RobotsPolicy
+	limiter *RequestLimiter
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a Robots Policy fetching each robots.txt File with the given
+// HTTP Transport, ignoring the robots.txt Files until Obey is set
+func NewRobotsPolicy(transport http.RoundTripper) *RobotsPolicy {
+	return &RobotsPolicy{
+		Agent:      DEFAULT_ROBOTS_AGENT,
+		RetryAfter: time.Millisecond * DEFAULT_ROBOTS_RETRY_AFTER,
+		client:     &http.Client{Transport: transport, Timeout: REQUEST_TIMEOUT},
+		hosts:      make(map[string]*robotsEntry),
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Error Message of a robots.txt Server Error
+func (e *RobotsStatusError) Error() string {
+	return fmt.Sprintf("robots.txt Unavailable: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the robots.txt File of the Host of the URL and the Group of rules for the
+// User Agent token, fetching it on first use, or once the error fetching it Expires
+func (p *RobotsPolicy) entry(u *url.URL) (*robotstxt.RobotsData, *robotstxt.Group, error) {
+
+	p.lock.Lock()
+	host := u.Scheme + "://" + u.Host
+	e, ok := p.hosts[host]
+	if !ok {
+		e = new(robotsEntry)
+		p.hosts[host] = e
+	}
+	p.lock.Unlock()
+
+	// Concurrent Requests to the Host wait for the one fetching the robots.txt File
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.data != nil || (e.err != nil && time.Now().Before(e.expires)) {
+		return e.data, e.group, e.err
+	}
+
+	e.data, e.err = p.fetch(host + "/robots.txt")
+	if e.err != nil {
+		e.expires = time.Now().Add(p.RetryAfter)
+		logger.Warn().Err(e.err).Str("Host", host).Dur("Retry After", p.RetryAfter).Msgf("%s robots.txt Unavailable, Fetching it again after the Retry After time", indent)
+		return nil, nil, e.err
+	}
+	e.group = e.data.FindGroup(p.Agent)
+	logger.Debug().Str("Host", host).Str("User Agent", e.group.Agent).Dur("Crawl Delay", e.group.CrawlDelay).Msgf("%s robots.txt Loaded", indent)
+
+	return e.data, e.group, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Fetch and Parse the robots.txt File, a missing File allows every URL while a
+// Server Error is returned as a RobotsStatusError
+func (p *RobotsPolicy) fetch(robotsURL string) (*robotstxt.RobotsData, error) {
+
+	req, err := http.NewRequest("GET", robotsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("[fetch] Invalid robots.txt URL: %w", err)
+	}
+	req.Header.Set("User-Agent", USER_AGENTS[0])
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("[fetch] robots.txt Request Failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return nil, &RobotsStatusError{StatusCode: resp.StatusCode}
+	}
+
+	data, err := robotstxt.FromResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("[fetch] robots.txt Parse Failed: %v", err)
+	}
+
+	return data, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Check the URL is Allowed by the robots.txt File of its Host, returning its Crawl-delay,
+// or ErrRobotsDisallowed if not. The error fetching the robots.txt File is returned as
+// is, so it may be Retried. Every URL is Allowed unless the Policy is to Obey.
+func (p *RobotsPolicy) Allowed(u *url.URL) (time.Duration, error) {
+	if !p.Obey {
+		return 0, nil
+	}
+
+	data, group, err := p.entry(u)
+	if err != nil {
+		return 0, err
+	}
+	if !data.TestAgent(u.RequestURI(), p.Agent) {
+		return 0, ErrRobotsDisallowed
+	}
+
+	return group.CrawlDelay, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Make the Request if the robots.txt File of the Host Allows it, first slowing
+// the Domain to no more than one Request per Crawl-delay
+func (t *robotsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	crawlDelay, err := t.robots.Allowed(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if crawlDelay > 0 {
+		t.limiter.domain(req.URL.Hostname()).applyCrawlDelay(crawlDelay)
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
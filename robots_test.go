@@ -0,0 +1,172 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Start a local HTTP Server returning the robots.txt content for /robots.txt,
+// and a page with a JSON-LD script block for everything else
+func newRobotsTestServer(t *testing.T, robots string, status int) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(status)
+			fmt.Fprint(w, robots)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><script type="application/ld+json">{"@type": "Thing"}</script></head></html>`)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeObeysRobots(t *testing.T) {
+	server := newRobotsTestServer(t, `
+User-agent: *
+Disallow: /
+
+User-agent: get-linked-data
+Disallow: /private
+Crawl-delay: 0.01
+`, http.StatusOK)
+
+	crawler, err := NewCrawler("", "", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.Robots.Obey = true
+	crawler.URLs = []string{server.URL + "/public", server.URL + "/private/a", server.URL + "/private?b"}
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	if scraped := results.ScrapedData(); len(scraped) != 1 || scraped[0].OriginalURL != server.URL+"/public" {
+		t.Errorf("expected only /public to be scraped, got %+v", scraped)
+	}
+	failed := results.FailedRequests()
+	if len(failed) != 2 {
+		t.Fatalf("expected 2 failed requests, got %+v", failed)
+	}
+	for _, failure := range failed {
+		if failure.Category != FAILURE_ROBOTS || !strings.Contains(failure.OriginalURL, "/private") {
+			t.Errorf("expected %s to fail as %s, got %s", failure.OriginalURL, FAILURE_ROBOTS, failure.Category)
+		}
+	}
+
+	// The Crawl-delay slows the Domain down
+	if d := crawler.Limiter.domain("127.0.0.1"); d.interval != 10*time.Millisecond {
+		t.Errorf("expected a 10ms interval from the Crawl-delay, got %v", d.interval)
+	}
+}
+
+func TestExecuteScrapeRobotsRecovers(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// The robots.txt File is Unavailable the first time it is fetched
+		if r.URL.Path == "/robots.txt" {
+			if fetches.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><script type="application/ld+json">{"@type": "Thing"}</script></head></html>`)
+	}))
+	t.Cleanup(server.Close)
+
+	crawler, err := NewCrawler("", "", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.Robots.Obey = true
+	crawler.Robots.RetryAfter = time.Millisecond
+	crawler.Retry.BaseDelay = 10 * time.Millisecond
+	crawler.Retry.MaxDelay = 10 * time.Millisecond
+	crawler.URLs = []string{server.URL + "/public"}
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	// The Request is Retried once the robots.txt File is fetched again
+	if scraped := results.ScrapedData(); len(scraped) != 1 || scraped[0].OriginalURL != server.URL+"/public" {
+		t.Errorf("expected /public to be scraped once retried, got %+v", scraped)
+	}
+	if failed := results.FailedRequests(); len(failed) != 0 {
+		t.Errorf("expected no failed requests, got %+v", failed)
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("expected robots.txt to be fetched twice, got %d", fetches.Load())
+	}
+
+	// The rules of the recovered robots.txt File are Obeyed
+	req, _ := http.NewRequest("GET", server.URL+"/private", nil)
+	if _, err := crawler.Robots.Allowed(req.URL); !errors.Is(err, ErrRobotsDisallowed) {
+		t.Errorf("expected /private to be disallowed, got %v", err)
+	}
+}
+
+func TestRobotsPolicyAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		robots  string
+		status  int
+		agent   string
+		obey    bool
+		allowed bool
+	}{
+		{"disallowed", "User-agent: *\nDisallow: /page", http.StatusOK, DEFAULT_ROBOTS_AGENT, true, false},
+		{"ignored", "User-agent: *\nDisallow: /page", http.StatusOK, DEFAULT_ROBOTS_AGENT, false, true},
+		{"other agent", "User-agent: other\nDisallow: /page", http.StatusOK, DEFAULT_ROBOTS_AGENT, true, true},
+		{"matched agent", "User-agent: other\nDisallow: /page", http.StatusOK, "other", true, false},
+		{"missing", "", http.StatusNotFound, DEFAULT_ROBOTS_AGENT, true, true},
+		{"server error", "", http.StatusServiceUnavailable, DEFAULT_ROBOTS_AGENT, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRobotsTestServer(t, tt.robots, tt.status)
+			policy := NewRobotsPolicy(http.DefaultTransport)
+			policy.Obey = tt.obey
+			policy.Agent = tt.agent
+
+			req, _ := http.NewRequest("GET", server.URL+"/page", nil)
+			if _, err := policy.Allowed(req.URL); (err == nil) != tt.allowed {
+				t.Errorf("expected allowed %v, got error %v", tt.allowed, err)
+			}
+		})
+	}
+}
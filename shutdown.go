@@ -0,0 +1,176 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+// Default Maximum Wait in Milliseconds for In-Flight Requests once the Crawl is Stopped
+const DEFAULT_SHUTDOWN_TIMEOUT = 30000
+
+// Error returned for each Request not made as the Crawl was Stopped
+var ErrShutdown = errors.New("Crawl Stopped before the Request was made")
+
+// HTTP Transport refusing every Request once the Crawl is Stopped, so the
+// Requests already queued by the Collector are dropped rather than made
+type shutdownTransport struct {
+	http.RoundTripper
+	stopping <-chan struct{}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Make the Request unless the Crawl has been Stopped
+func (t *shutdownTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-t.stopping:
+		return nil, ErrShutdown
+	default:
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Stop the Crawl Gracefully, no further Requests are made while those In-Flight
+// are given until the Shutdown Timeout to complete. Safe to call more than once.
+func (c *Crawler) Stop() {
+	c.stopOnce.Do(func() {
+		logger.Warn().Dur("Shutdown Timeout", c.ShutdownTimeout).Msgf("%s Stopping the Crawl, Signal again to Exit Immediately", indent)
+		close(c.stopping)
+	})
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return whether the Crawl has been Stopped
+func (c *Crawler) Stopped() bool {
+	select {
+	case <-c.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Wait for the Collector to finish, or once the Crawl is Stopped, for no longer than
+// the Shutdown Timeout. Returns false if Requests were still In-Flight, in which case
+// the Output Sinks are Detached so any late results are discarded.
+func (c *Crawler) waitForCollector() bool {
+
+	done := make(chan struct{})
+	go func() {
+		c.Collector.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-c.stopping:
+	}
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(c.ShutdownTimeout):
+	}
+
+	// Hold the Sink Lock so no write is in progress once the Sinks are Detached
+	c.sinkLock.Lock()
+	defer c.sinkLock.Unlock()
+	c.sinksDetached = true
+
+	return false
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the URLs which were not Scraped and did not Fail, in the order they were
+// loaded, followed by any URLs Streamed or Links Discovered in the order they were queued
+func (c *Crawler) PendingURLs() []string {
+	c.followLock.Lock()
+	urls := append(slices.Clip(c.URLs), c.discovered...)
+	c.followLock.Unlock()
+
+	c.sinkLock.Lock()
+	defer c.sinkLock.Unlock()
+
+	var pending []string
+	for _, url := range urls {
+		if !c.completed[url] {
+			pending = append(pending, url)
+		}
+	}
+
+	return pending
+}
+
+//---------------------------------------------------------------------------------------
+
+// Write the Pending URLs to the named CSV File, one per row in the Layout of the
+// Input File, beginning with its Header Row if it had one and with the Pass Through
+// Columns of each URL, ready to be provided as the CSV File containing URLs to
+// Scrape on a later crawl with the same options
+func (c *Crawler) WritePendingFile(name string, delimiter string) error {
+
+	pending := c.PendingURLs()
+	logger.Info().Int("Pending URLs", len(pending)).Str("File", name).Msgf("%s Writing Pending URL List", indent)
+
+	// Open file ready for writing
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("[WritePendingFile] Create File Failed: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Comma = rune(delimiter[0])
+	if c.InputLayout.Header != nil {
+		if err := w.Write(c.InputLayout.Header); err != nil {
+			return fmt.Errorf("[WritePendingFile] Failed Writing the Header: %w", err)
+		}
+	}
+
+	// Links Discovered have no Pass Through Columns, so they are left empty
+	c.followLock.Lock()
+	defer c.followLock.Unlock()
+	for _, url := range pending {
+		if err := w.Write(c.InputLayout.row(url, c.inputs[url])); err != nil {
+			return fmt.Errorf("[WritePendingFile] Failed Writing to the File: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("[WritePendingFile] Failed Flushing the File: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("[WritePendingFile] Failed Closing the File: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Start a local HTTP Server holding the first page requested until released,
+// returning a channel receiving its request, and a function releasing it
+func newSlowTestServer(t *testing.T) (*httptest.Server, <-chan struct{}, func()) {
+	t.Helper()
+
+	var requests atomic.Int32
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			arrived <- struct{}{}
+			<-release
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><script type="application/ld+json">{"@type": "Thing"}</script></head></html>`)
+	}))
+
+	var released bool
+	releaseAll := func() {
+		if !released {
+			released = true
+			close(release)
+		}
+	}
+	t.Cleanup(func() {
+		releaseAll()
+		server.Close()
+	})
+
+	return server, arrived, releaseAll
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeStopLeavesURLsPending(t *testing.T) {
+	server, arrived, release := newSlowTestServer(t)
+	crawler, err := NewCrawler("", "", "", nil, 0, 1)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.URLs = []string{server.URL + "/a", server.URL + "/b", server.URL + "/c"}
+
+	// Stop while the first page is In-Flight, then let it complete
+	go func() {
+		<-arrived
+		crawler.Stop()
+		release()
+	}()
+
+	results := NewResultStore()
+	err = crawler.ExecuteScrape(results, results, results, false, false)
+	if !errors.Is(err, ErrShutdown) {
+		t.Fatalf("expected ErrShutdown, got %v", err)
+	}
+
+	// The In-Flight page is written, the queued pages are neither Visited nor reported as Failed
+	scraped := results.ScrapedData()
+	if len(scraped) != 1 {
+		t.Fatalf("expected only the in-flight page to be scraped, got %+v", scraped)
+	}
+	if failed := results.FailedRequests(); len(failed) != 0 {
+		t.Errorf("expected no failed requests, got %+v", failed)
+	}
+	var expected strings.Builder
+	for _, url := range crawler.URLs {
+		if url != scraped[0].OriginalURL {
+			expected.WriteString(url + "\n")
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "pending.csv")
+	if err := crawler.WritePendingFile(name, ","); err != nil {
+		t.Fatalf("WritePendingFile failed: %v", err)
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(content) != expected.String() {
+		t.Errorf("expected %q, got %q", expected.String(), string(content))
+	}
+}
+
+func TestExecuteScrapeStopTimeout(t *testing.T) {
+	server, arrived, release := newSlowTestServer(t)
+	crawler, err := NewCrawler("", "", "", nil, 0, 1)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.ShutdownTimeout = 50 * time.Millisecond
+	crawler.URLs = []string{server.URL + "/a"}
+
+	go func() {
+		<-arrived
+		crawler.Stop()
+	}()
+
+	results := NewResultStore()
+	err = crawler.ExecuteScrape(results, results, results, false, false)
+	if !errors.Is(err, ErrShutdown) {
+		t.Fatalf("expected ErrShutdown, got %v", err)
+	}
+
+	// The page still In-Flight when the timeout was reached is left Pending, and its late result discarded
+	if pending := crawler.PendingURLs(); !reflect.DeepEqual(pending, crawler.URLs) {
+		t.Errorf("expected %v pending, got %v", crawler.URLs, pending)
+	}
+	release()
+	crawler.Collector.Wait()
+	if scraped := results.ScrapedData(); len(scraped) != 0 {
+		t.Errorf("expected the late result to be discarded, got %+v", scraped)
+	}
+}
+
+func TestWritePendingFileKeepsInputLayout(t *testing.T) {
+	name := writeTestFile(t, "urls.csv", "sku,link,category\nA-1,https://example.com/a,shoes\nB-1,https://example.com/b\n")
+
+	crawler, err := NewCrawler("", "", "", nil, 0, 1)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	if err := crawler.LoadUrlFile(name, InputOptions{Delimiter: ",", URLColumn: "link", PassThrough: true}); err != nil {
+		t.Fatalf("LoadUrlFile failed: %v", err)
+	}
+
+	// A Link Discovered has no Pass Through Columns
+	crawler.discovered = []string{"https://example.com/c"}
+
+	pending := filepath.Join(t.TempDir(), "pending.csv")
+	if err := crawler.WritePendingFile(pending, ","); err != nil {
+		t.Fatalf("WritePendingFile failed: %v", err)
+	}
+	content, err := os.ReadFile(pending)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	expected := "sku,link,category\nA-1,https://example.com/a,shoes\nB-1,https://example.com/b,\n,https://example.com/c,\n"
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, string(content))
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Output File Formats of the Scraped Data
+const FORMAT_CSV = "csv"
+const FORMAT_JSONL = "jsonl"
+const FORMAT_JSON = "json"
+const FORMAT_PARQUET = "parquet"
+const FORMAT_SQLITE = "sqlite"
+
+// Scraped Data along with the details of the Page it was Scraped from
+type ScrapedRecord struct {
+	OriginalURL  string
+	FinalURL     string
+	StatusCode   int
+	FetchedAt    time.Time
+	ElementIndex int
+	Type         string
+	Syntax       string
+	Data         string
+	Input        InputColumns
+}
+
+// Details of a Request which Failed, or which was Rejected before it was made
+type FailedRequest struct {
+	OriginalURL string
+	StatusCode  int
+	Category    string
+	Error       string
+	Attempts    int
+	FailedAt    time.Time
+}
+
+// Options of the Output Sinks, each only applies to the Formats supporting it.
+// Columns names the Input File Columns Passed Through alongside each Record.
+type SinkOptions struct {
+	Delimiter    string
+	Fields       Fields
+	RowGroupSize int
+	Append       bool
+	Columns      []string
+}
+
+// Page which loaded successfully yet yielded no Records, or had Elements
+// Rejected as they were not valid JSON or the jq Selector failed or selected
+// nothing, along with the reason for the first Rejection
+type RejectedPage struct {
+	OriginalURL string
+	FinalURL    string
+	StatusCode  int
+	Records     int
+	Rejected    int
+	Reason      string
+	Error       string
+}
+
+// Output Sink receiving each Scraped Record as soon as it has been Scraped.
+// Calls to every Output Sink are serialised by the Crawler, so implementations
+// need not be safe for concurrent use.
+type DataSink interface {
+	WriteRecord(record ScrapedRecord) error
+	Close() error
+}
+
+// Output Sink receiving each Failed Request as soon as it has Failed
+type ErrorSink interface {
+	WriteFailure(failure FailedRequest) error
+	Close() error
+}
+
+// Output Sink receiving each Rejected Page as soon as it has been Scraped
+type RejectSink interface {
+	WriteRejected(page RejectedPage) error
+	Close() error
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of the Data Sink writing the named File in the requested Format
+func NewDataSink(format string, name string, options SinkOptions) (DataSink, error) {
+
+	switch format {
+	case FORMAT_CSV:
+		return NewCSVDataSink(name, options.Delimiter, options.Fields, options.Columns, options.Append)
+	case FORMAT_JSONL:
+		return NewJSONDataSink(name, false, options.Append)
+	case FORMAT_JSON:
+		return NewJSONDataSink(name, true, options.Append)
+	case FORMAT_PARQUET:
+		if options.Append {
+			return nil, fmt.Errorf("[NewDataSink] Parquet Files can not be Appended to")
+		}
+		return NewParquetDataSink(name, options.Fields, options.Columns, options.RowGroupSize)
+	case FORMAT_SQLITE:
+		return NewSQLiteSink(name)
+	}
+
+	return nil, fmt.Errorf("[NewDataSink] Unknown Output Format: %s", format)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Open the named Output File for writing, Appending to any existing content
+// when Resuming a crawl, otherwise Truncating it
+func openOutputFile(name string, resume bool) (*os.File, error) {
+
+	if !resume {
+		file, err := os.Create(name)
+		if err != nil {
+			return nil, fmt.Errorf("Create File Failed: %w", err)
+		}
+		return file, nil
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return nil, fmt.Errorf("Open File for Append Failed: %w", err)
+	}
+	return file, nil
+}
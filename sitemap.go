@@ -0,0 +1,304 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// Most Sitemaps followed from each Sitemap provided, guarding against Sitemap Index loops
+const MAX_SITEMAPS = 10000
+
+// Largest Sitemap read, both as fetched and once decompressed, as allowed by the Sitemap protocol
+const MAX_SITEMAP_SIZE = 50 * 1024 * 1024
+
+// Error returned for a Sitemap larger than the Maximum Sitemap Size
+var ErrSitemapTooLarge = errors.New("Sitemap Exceeds 50 MB")
+
+// Layouts of the W3C Datetime format used by the Sitemap lastmod element
+var sitemapTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// Sitemap URLs provided as a flag, which may be Repeated
+type SitemapURLs []string
+
+// Filter of the Sitemap Entries, either may be empty
+type SitemapFilter struct {
+	Match *regexp.Regexp
+	Since time.Time
+}
+
+// Entry of either a Sitemap or a Sitemap Index
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Sitemap URLs as a flag value
+func (s *SitemapURLs) String() string {
+	return strings.Join(*s, ",")
+}
+
+//---------------------------------------------------------------------------------------
+
+// Append a Site Root or Sitemap URL
+func (s *SitemapURLs) Set(value string) error {
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Sitemap must be an http or https URL: %s", value)
+	}
+
+	*s = append(*s, value)
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Load the URL of every Page listed by the Sitemaps, following Sitemap Index Files,
+// and Append those passing the Filter to the URL List. A Site Root is replaced by
+// the Sitemaps of its robots.txt File, or /sitemap.xml if it lists none.
+func (c *Crawler) LoadSitemaps(sitemapURLs SitemapURLs, filter SitemapFilter) error {
+
+	logger.Info().Msgf("%s Loading Sitemaps", indent)
+
+	client := &http.Client{Timeout: REQUEST_TIMEOUT}
+	for _, sitemapURL := range sitemapURLs {
+		u, err := url.Parse(sitemapURL)
+		if err != nil {
+			return fmt.Errorf("[LoadSitemaps] Invalid Sitemap URL: %w", err)
+		}
+
+		queue := []string{sitemapURL}
+		if u.Path == "" || u.Path == "/" {
+			queue, err = siteSitemaps(client, u)
+			if err != nil {
+				return fmt.Errorf("[LoadSitemaps] %w", err)
+			}
+		}
+
+		// Follow each Sitemap Index breadth first, a Sitemap which fails is logged and skipped
+		count := 0
+		visited := make(map[string]bool)
+		for len(queue) > 0 && len(visited) < MAX_SITEMAPS {
+			next := queue[0]
+			queue = queue[1:]
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+
+			pages, sitemaps, err := fetchSitemap(client, next, filter)
+			if err != nil {
+				logger.Warn().Err(err).Str("Sitemap", next).Msg(doubleIndent)
+				continue
+			}
+			logger.Debug().Int("Pages", len(pages)).Int("Sitemaps", len(sitemaps)).Str("Sitemap", next).Msg(doubleIndent)
+			c.URLs = append(c.URLs, pages...)
+			queue = append(queue, sitemaps...)
+			count += len(pages)
+		}
+
+		logger.Info().Int("Sitemaps", len(visited)).Int("Pages", count).Str("Sitemap", sitemapURL).Msg(doubleIndent)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Sitemaps listed by the robots.txt File of the Site, or /sitemap.xml if none
+func siteSitemaps(client *http.Client, site *url.URL) ([]string, error) {
+
+	robotsURL := site.ResolveReference(&url.URL{Path: "/robots.txt"}).String()
+	body, status, err := fetchBody(client, robotsURL)
+	if err != nil {
+		return nil, fmt.Errorf("[siteSitemaps] robots.txt Request Failed: %w", err)
+	}
+
+	var sitemaps []string
+	if status >= 200 && status < 300 {
+		robots, err := robotstxt.FromBytes(body)
+		if err != nil {
+			return nil, fmt.Errorf("[siteSitemaps] robots.txt Parse Failed: %w", err)
+		}
+		sitemaps = robots.Sitemaps
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = []string{site.ResolveReference(&url.URL{Path: "/sitemap.xml"}).String()}
+	}
+
+	return sitemaps, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Fetch and Parse the Sitemap, returning the Pages of a Sitemap or the Sitemaps of a
+// Sitemap Index which pass the Filter. The lastmod of a Sitemap Index Entry is
+// compared as its Pages can not have changed since.
+func fetchSitemap(client *http.Client, sitemapURL string, filter SitemapFilter) ([]string, []string, error) {
+
+	resp, err := fetchURL(client, sitemapURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[fetchSitemap] Request Failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("[fetchSitemap] Request Failed: %s", http.StatusText(resp.StatusCode))
+	}
+
+	// Read no more than the Maximum Sitemap Size, reading one byte more to tell a Sitemap
+	// of exactly the Maximum Sitemap Size from one exceeding it
+	body := &io.LimitedReader{R: resp.Body, N: MAX_SITEMAP_SIZE + 1}
+	buffered := bufio.NewReader(body)
+	var reader io.Reader = buffered
+	exceeded := func() bool { return body.N <= 0 }
+
+	// Decompress a gzipped Sitemap, which is served as is rather than with a Content-Encoding,
+	// again reading no more than the Maximum Sitemap Size once decompressed
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[fetchSitemap] gzip Reader Failed: %w", err)
+		}
+		defer gz.Close()
+		decompressed := &io.LimitedReader{R: gz, N: MAX_SITEMAP_SIZE + 1}
+		reader = decompressed
+		exceeded = func() bool { return body.N <= 0 || decompressed.N <= 0 }
+	}
+
+	// Decode the Entries as the Body is read, as a Sitemap may hold up to 50,000 of them
+	var pages, sitemaps []string
+	decoder := xml.NewDecoder(reader)
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if exceeded() {
+			return nil, nil, fmt.Errorf("[fetchSitemap] Read Failed: %w", ErrSitemapTooLarge)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("[fetchSitemap] XML Decode Failed: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || (start.Name.Local != "url" && start.Name.Local != "sitemap") {
+			continue
+		}
+		var entry sitemapEntry
+		if err := decoder.DecodeElement(&entry, &start); err != nil {
+			if exceeded() {
+				return nil, nil, fmt.Errorf("[fetchSitemap] Read Failed: %w", ErrSitemapTooLarge)
+			}
+			return nil, nil, fmt.Errorf("[fetchSitemap] XML Decode Failed: %w", err)
+		}
+		entry.Loc = strings.TrimSpace(entry.Loc)
+		if entry.Loc == "" || !filter.includesLastMod(entry.LastMod) {
+			continue
+		}
+
+		if start.Name.Local == "sitemap" {
+			sitemaps = append(sitemaps, entry.Loc)
+		} else if filter.Match == nil || filter.Match.MatchString(entry.Loc) {
+			pages = append(pages, entry.Loc)
+		}
+	}
+
+	return pages, sitemaps, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Response of the URL, the caller Closes its Body
+func fetchURL(client *http.Client, rawURL string) (*http.Response, error) {
+
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", USER_AGENTS[0])
+
+	return client.Do(req)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return the Body and Status Code of the URL, reading no more than the Maximum Sitemap Size
+func fetchBody(client *http.Client, rawURL string) ([]byte, int, error) {
+
+	resp, err := fetchURL(client, rawURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MAX_SITEMAP_SIZE))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return body, resp.StatusCode, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return whether an Entry last modified at the lastmod value passes the Filter, an
+// Entry without a valid lastmod always passes as it may have changed
+func (f SitemapFilter) includesLastMod(lastMod string) bool {
+	if f.Since.IsZero() {
+		return true
+	}
+
+	modified, ok := parseSitemapTime(strings.TrimSpace(lastMod))
+	if !ok {
+		return true
+	}
+
+	return !modified.Before(f.Since)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Parse a W3C Datetime value, as used by the Sitemap lastmod element
+func parseSitemapTime(value string) (time.Time, bool) {
+	for _, layout := range sitemapTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,154 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Start a local HTTP Server publishing a Sitemap Index through its robots.txt,
+// listing a gzipped Sitemap of Products and an older Sitemap of Pages
+func newSitemapTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow:\nSitemap: %s/sitemap_index.xml\n", server.URL)
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/products.xml.gz</loc><lastmod>2024-05-01T10:00:00+00:00</lastmod></sitemap>
+  <sitemap><loc>%[1]s/pages.xml</loc><lastmod>2020-01-01</lastmod></sitemap>
+  <sitemap><loc>%[1]s/sitemap_index.xml</loc></sitemap>
+</sitemapindex>`, server.URL)
+		case "/products.xml.gz":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			fmt.Fprintf(gz, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/product/1</loc><lastmod>2024-04-30</lastmod></url>
+  <url><loc> %[1]s/product/2 </loc></url>
+  <url><loc>%[1]s/product/3</loc><lastmod>2023-12-31</lastmod></url>
+  <url><loc>%[1]s/category/1</loc><lastmod>2024-04-30</lastmod></url>
+</urlset>`, server.URL)
+			gz.Close()
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(buf.Bytes())
+		case "/pages.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/about</loc></url></urlset>`, server.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestLoadSitemaps(t *testing.T) {
+	server := newSitemapTestServer(t)
+
+	tests := []struct {
+		name     string
+		sitemap  string
+		filter   SitemapFilter
+		expected []string
+	}{
+		{"site root", server.URL, SitemapFilter{}, []string{"/about", "/category/1", "/product/1", "/product/2", "/product/3"}},
+		{"sitemap", server.URL + "/pages.xml", SitemapFilter{}, []string{"/about"}},
+		{"match", server.URL + "/", SitemapFilter{Match: regexp.MustCompile(`/product/`)}, []string{"/product/1", "/product/2", "/product/3"}},
+		{"since", server.URL, SitemapFilter{Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, []string{"/category/1", "/product/1", "/product/2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Crawler{}
+			if err := c.LoadSitemaps(SitemapURLs{tt.sitemap}, tt.filter); err != nil {
+				t.Fatalf("LoadSitemaps failed: %v", err)
+			}
+
+			var expected []string
+			for _, path := range tt.expected {
+				expected = append(expected, server.URL+path)
+			}
+			sort.Strings(c.URLs)
+			if !reflect.DeepEqual(c.URLs, expected) {
+				t.Errorf("expected %v, got %v", expected, c.URLs)
+			}
+		})
+	}
+}
+
+func TestFetchSitemapTooLarge(t *testing.T) {
+
+	// A Sitemap padded past the Maximum Sitemap Size, served as is and gzipped
+	sitemap := []byte("<urlset>" + strings.Repeat(" ", MAX_SITEMAP_SIZE) + "</urlset>")
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(sitemap)
+	gz.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			w.Write(sitemap)
+		case "/sitemap.xml.gz":
+			w.Write(gzipped.Bytes())
+		default:
+			fmt.Fprint(w, "<urlset><url><loc>https://example.com/</loc></url></urlset>")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	for _, path := range []string{"/sitemap.xml", "/sitemap.xml.gz"} {
+		if _, _, err := fetchSitemap(server.Client(), server.URL+path, SitemapFilter{}); !errors.Is(err, ErrSitemapTooLarge) {
+			t.Errorf("%s: expected ErrSitemapTooLarge, got %v", path, err)
+		}
+	}
+	if pages, _, err := fetchSitemap(server.Client(), server.URL+"/small.xml", SitemapFilter{}); err != nil || len(pages) != 1 {
+		t.Errorf("expected 1 page, got %v, %v", pages, err)
+	}
+}
+
+func TestSitemapURLsSet(t *testing.T) {
+	var s SitemapURLs
+	for _, value := range []string{"https://example.com", "http://example.com/sitemap.xml"} {
+		if err := s.Set(value); err != nil {
+			t.Errorf("Set %s failed: %v", value, err)
+		}
+	}
+	for _, value := range []string{"example.com", "ftp://example.com/sitemap.xml", "https://"} {
+		if err := s.Set(value); err == nil {
+			t.Errorf("expected an error setting %s", value)
+		}
+	}
+	if s.String() != "https://example.com,http://example.com/sitemap.xml" {
+		t.Errorf("unexpected sitemaps %s", s.String())
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Schema of the SQLite Database, created if it does not already exist. Records
+// are keyed by the Original URL and a hash of the Scraped Data, so a record
+// scraped again on a later crawl updates the existing row.
+const SQLITE_SCHEMA = `
+CREATE TABLE IF NOT EXISTS records (
+	url           TEXT    NOT NULL,
+	record_hash   TEXT    NOT NULL,
+	final_url     TEXT    NOT NULL,
+	status_code   INTEGER NOT NULL,
+	element_index INTEGER NOT NULL,
+	type          TEXT    NOT NULL,
+	syntax        TEXT    NOT NULL,
+	data          TEXT    NOT NULL,
+	first_seen    TEXT    NOT NULL,
+	last_seen     TEXT    NOT NULL,
+	input         TEXT    NOT NULL DEFAULT '{}',
+	PRIMARY KEY (url, record_hash)
+);
+CREATE TABLE IF NOT EXISTS failures (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	url         TEXT    NOT NULL,
+	status_code INTEGER NOT NULL,
+	category    TEXT    NOT NULL,
+	error       TEXT    NOT NULL,
+	attempts    INTEGER NOT NULL,
+	failed_at   TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS failures_url ON failures (url);
+`
+
+// Timestamps are stored as fixed width UTC text, so they also sort chronologically
+const SQLITE_TIME_FORMAT = "2006-01-02T15:04:05.000Z"
+
+const SQLITE_UPSERT_RECORD = `
+INSERT INTO records (url, record_hash, final_url, status_code, element_index, type, syntax, data, first_seen, last_seen, input)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (url, record_hash) DO UPDATE SET
+	final_url     = excluded.final_url,
+	status_code   = excluded.status_code,
+	element_index = excluded.element_index,
+	type          = excluded.type,
+	syntax        = excluded.syntax,
+	input         = excluded.input,
+	first_seen    = MIN(first_seen, excluded.first_seen),
+	last_seen     = MAX(last_seen, excluded.last_seen)
+`
+
+const SQLITE_INSERT_FAILURE = `
+INSERT INTO failures (url, status_code, category, error, attempts, failed_at) VALUES (?, ?, ?, ?, ?, ?)
+`
+
+// Sink accumulating the Scraped Records and Failed Requests of every crawl in
+// a SQLite Database, implementing both the Data Sink and the Error Sink
+type SQLiteSink struct {
+	db            *sql.DB
+	upsertRecord  *sql.Stmt
+	insertFailure *sql.Stmt
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return New Instance of a SQLite Sink writing to the named Database, which
+// is created along with its Schema if it does not already exist
+func NewSQLiteSink(name string) (*SQLiteSink, error) {
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", name))
+	if err != nil {
+		return nil, fmt.Errorf("[NewSQLiteSink] Open Database Failed: %w", err)
+	}
+
+	// Writes are serialised by the Crawler, so a single connection is sufficient
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(SQLITE_SCHEMA); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("[NewSQLiteSink] Create Schema Failed: %w", err)
+	}
+
+	upsertRecord, err := db.Prepare(SQLITE_UPSERT_RECORD)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("[NewSQLiteSink] Prepare Statement Failed: %w", err)
+	}
+
+	insertFailure, err := db.Prepare(SQLITE_INSERT_FAILURE)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("[NewSQLiteSink] Prepare Statement Failed: %w", err)
+	}
+
+	return &SQLiteSink{db: db, upsertRecord: upsertRecord, insertFailure: insertFailure}, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Insert the Scraped Record, or update the existing row and its last seen time,
+// storing the Input Columns as a JSON Object
+func (s *SQLiteSink) WriteRecord(record ScrapedRecord) error {
+
+	hash := sha256.Sum256([]byte(record.Data))
+	seen := record.FetchedAt.UTC().Format(SQLITE_TIME_FORMAT)
+	input, err := json.Marshal(record.Input)
+	if err != nil {
+		return fmt.Errorf("[WriteRecord] JSON Marshal Failed: %w", err)
+	}
+
+	_, err = s.upsertRecord.Exec(
+		record.OriginalURL,
+		hex.EncodeToString(hash[:]),
+		record.FinalURL,
+		record.StatusCode,
+		record.ElementIndex,
+		record.Type,
+		record.Syntax,
+		record.Data,
+		seen,
+		seen,
+		string(input),
+	)
+	if err != nil {
+		return fmt.Errorf("[WriteRecord] Upsert Record Failed: %w", err)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Insert the Failed Request along with the time it failed
+func (s *SQLiteSink) WriteFailure(failure FailedRequest) error {
+
+	_, err := s.insertFailure.Exec(
+		failure.OriginalURL,
+		failure.StatusCode,
+		failure.Category,
+		failure.Error,
+		failure.Attempts,
+		failure.FailedAt.UTC().Format(SQLITE_TIME_FORMAT),
+	)
+	if err != nil {
+		return fmt.Errorf("[WriteFailure] Insert Failure Failed: %w", err)
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Close the Database, which is safe to call once as a Data Sink and again as an Error Sink
+func (s *SQLiteSink) Close() error {
+
+	if s.db == nil {
+		return nil
+	}
+
+	s.upsertRecord.Close()
+	s.insertFailure.Close()
+	err := s.db.Close()
+	s.db = nil
+	if err != nil {
+		return fmt.Errorf("[Close] Failed Closing the Database: %w", err)
+	}
+
+	return nil
+}
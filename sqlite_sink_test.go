@@ -0,0 +1,152 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteSinkUpsertsAcrossCrawls(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "results.db")
+	firstCrawl := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	secondCrawl := firstCrawl.AddDate(0, 0, 7)
+
+	record := ScrapedRecord{
+		OriginalURL: "https://example.com/a",
+		FinalURL:    "https://example.com/a",
+		StatusCode:  200,
+		Type:        "Product",
+		Syntax:      SYNTAX_JSONLD,
+		Data:        `{"sku":"A"}`,
+	}
+	changed := record
+	changed.Data = `{"sku":"A","price":2}`
+
+	// The first crawl scrapes the record, the second crawl scrapes it again along with a changed record
+	crawls := []struct {
+		fetchedAt time.Time
+		records   []ScrapedRecord
+	}{
+		{firstCrawl, []ScrapedRecord{record}},
+		{secondCrawl, []ScrapedRecord{record, changed}},
+	}
+	for _, crawl := range crawls {
+		sink, err := NewSQLiteSink(name)
+		if err != nil {
+			t.Fatalf("NewSQLiteSink failed: %v", err)
+		}
+		for _, r := range crawl.records {
+			r.FetchedAt = crawl.fetchedAt
+			if err := sink.WriteRecord(r); err != nil {
+				t.Fatalf("WriteRecord failed: %v", err)
+			}
+		}
+		if err := sink.WriteFailure(FailedRequest{OriginalURL: "https://example.com/missing", StatusCode: 404, Category: FAILURE_NOT_FOUND, Error: "Not Found", Attempts: 1, FailedAt: crawl.fetchedAt}); err != nil {
+			t.Fatalf("WriteFailure failed: %v", err)
+		}
+
+		// Closing as both the Data Sink and the Error Sink must be safe
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("second Close failed: %v", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", name)
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT data, first_seen, last_seen FROM records ORDER BY first_seen, data`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	expected := [][3]string{
+		{`{"sku":"A"}`, "2024-01-01T00:00:00.000Z", "2024-01-08T00:00:00.000Z"},
+		{`{"sku":"A","price":2}`, "2024-01-08T00:00:00.000Z", "2024-01-08T00:00:00.000Z"},
+	}
+	var actual [][3]string
+	for rows.Next() {
+		var row [3]string
+		if err := rows.Scan(&row[0], &row[1], &row[2]); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		actual = append(actual, row)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d records, got %v", len(expected), actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("record %d: expected %v, got %v", i, expected[i], actual[i])
+		}
+	}
+
+	var failures, statusCode, attempts int
+	var category, message, failedAt string
+	row := db.QueryRow(`SELECT COUNT(*), MAX(status_code), MAX(category), MAX(error), MAX(attempts), MAX(failed_at) FROM failures`)
+	if err := row.Scan(&failures, &statusCode, &category, &message, &attempts, &failedAt); err != nil {
+		t.Fatalf("QueryRow failed: %v", err)
+	}
+	if failures != 2 || statusCode != 404 || category != FAILURE_NOT_FOUND || message != "Not Found" || attempts != 1 || failedAt != "2024-01-08T00:00:00.000Z" {
+		t.Errorf("unexpected failures, got %d, %d, %q, %q, %d, %q", failures, statusCode, category, message, attempts, failedAt)
+	}
+}
+
+func TestSQLiteSinkStoresInputColumns(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "results.db")
+
+	sink, err := NewSQLiteSink(name)
+	if err != nil {
+		t.Fatalf("NewSQLiteSink failed: %v", err)
+	}
+	records := []ScrapedRecord{
+		{OriginalURL: "https://example.com/a", Syntax: SYNTAX_JSONLD, Data: `{"sku":"A"}`, Input: InputColumns{{Name: "sku", Value: "A-1"}}},
+		{OriginalURL: "https://example.com/b", Syntax: SYNTAX_JSONLD, Data: `{"sku":"B"}`},
+	}
+	for _, record := range records {
+		if err := sink.WriteRecord(record); err != nil {
+			t.Fatalf("WriteRecord failed: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", name)
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	defer db.Close()
+
+	// A Record without Input Columns, such as one from a Followed Link, stores an empty Object
+	for url, expected := range map[string]string{"https://example.com/a": `{"sku":"A-1"}`, "https://example.com/b": `{}`} {
+		var input string
+		if err := db.QueryRow(`SELECT input FROM records WHERE url = ?`, url).Scan(&input); err != nil {
+			t.Fatalf("QueryRow failed: %v", err)
+		}
+		if input != expected {
+			t.Errorf("%s: expected input %s, got %s", url, expected, input)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gocolly/colly"
+)
+
+// Slot of the Stream Queue held by a Streamed URL, held in the Request Context
+const STREAM_SLOT = "STREAM_SLOT"
+
+// Maximum number of Streamed URLs queued or In-Flight at once, so the Input is
+// only Read as quickly as the URLs are Scraped
+const STREAM_QUEUE_SIZE = 10000
+
+// Slot of the Stream Queue, released once the Request has Completed or Failed
+type streamSlot struct {
+	once  sync.Once
+	slots chan struct{}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Queue a Visit to each URL Read from the Input, if provided, once a Slot of the
+// Stream Queue is free. A URL already Visited, or recorded as done in the
+// Checkpoint, is skipped. Returns nil once the Input is exhausted or the Crawl is Stopped.
+func (c *Crawler) streamInput(scrapeGoogleWebCache bool) error {
+
+	if c.Input == nil {
+		return nil
+	}
+
+	logger.Info().Msgf("%s Streaming URL List", indent)
+
+	slots := make(chan struct{}, STREAM_QUEUE_SIZE)
+	for !c.Stopped() {
+		input, err := c.Input.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("[streamInput] %w", err)
+		}
+		rawURL := input.URL
+
+		if c.checkpointDone(rawURL) || !c.markVisited(rawURL, input.Columns) {
+			continue
+		}
+
+		// Allow the Domain of each Streamed URL as it arrives
+		if err := c.Allowed.AddURL(rawURL); err != nil {
+			c.writeFailure(newFailedRequest(rawURL, 0, err, 0))
+			logger.Error().Err(err).Str("Visited", rawURL).Msg(doubleIndent)
+			continue
+		}
+
+		// Wait for a free Slot, the URL is left Pending if the Crawl is Stopped meanwhile
+		select {
+		case slots <- struct{}{}:
+		case <-c.stopping:
+			return nil
+		}
+
+		slot := &streamSlot{slots: slots}
+		ctx := colly.NewContext()
+		ctx.Put(STREAM_SLOT, slot)
+		if !c.visit(rawURL, input.Columns, ctx, scrapeGoogleWebCache) {
+			slot.release()
+		}
+	}
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// Return whether the Checkpoint, if provided, records the URL as done
+func (c *Crawler) checkpointDone(url string) bool {
+	if c.Checkpoint == nil {
+		return false
+	}
+
+	c.sinkLock.Lock()
+	defer c.sinkLock.Unlock()
+
+	return c.Checkpoint.State(url) == CHECKPOINT_DONE
+}
+
+//---------------------------------------------------------------------------------------
+
+// Release the Slot of the Stream Queue held by the Request, if any
+func releaseStreamSlot(ctx *colly.Context) {
+	if slot, ok := ctx.GetAny(STREAM_SLOT).(*streamSlot); ok {
+		slot.release()
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// Release the Slot, only the first call has any effect
+func (s *streamSlot) release() {
+	s.once.Do(func() {
+		<-s.slots
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright 2023-2024, Matthew Winter
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExecuteScrapeStreamsInput(t *testing.T) {
+	const pageCount = 50
+
+	server := newTestServer(t)
+	var content strings.Builder
+	for i := 0; i < pageCount; i++ {
+		fmt.Fprintf(&content, "%s/product/%d\n%s/product/%d\n", server.URL, i, server.URL, i%10)
+	}
+	reader, err := OpenURLReader(writeTestFile(t, "urls.txt", content.String()), InputOptions{})
+	if err != nil {
+		t.Fatalf("OpenURLReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	crawler, err := NewCrawler("", ".sku", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.URLs = []string{server.URL + "/product/0"}
+	crawler.Input = reader
+
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err != nil {
+		t.Fatalf("ExecuteScrape failed: %v", err)
+	}
+
+	// Each Page is Scraped once however often it is Streamed, or if it was also Loaded
+	seen := make(map[string]int)
+	for _, record := range results.ScrapedData() {
+		seen[record.Data]++
+	}
+	if len(seen) != pageCount*2 {
+		t.Fatalf("expected %d distinct records, got %d", pageCount*2, len(seen))
+	}
+	for data, count := range seen {
+		if count != 1 {
+			t.Errorf("record %s scraped %d times", data, count)
+		}
+	}
+	if pending := crawler.PendingURLs(); len(pending) != 0 {
+		t.Errorf("expected no pending URLs, got %v", pending)
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+func TestExecuteScrapeStreamInputError(t *testing.T) {
+	server := newTestServer(t)
+	content := fmt.Sprintf(`{"url": "%s/product/1"}`+"\n"+`not json`+"\n", server.URL)
+	reader, err := OpenURLReader(writeTestFile(t, "urls.jsonl", content), InputOptions{})
+	if err != nil {
+		t.Fatalf("OpenURLReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	crawler, err := NewCrawler("", ".sku", "", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+	crawler.ExtractJSONLD = true
+	crawler.Input = reader
+
+	// The URLs queued before the error are still Scraped
+	results := NewResultStore()
+	if err := crawler.ExecuteScrape(results, results, results, false, false); err == nil || !strings.Contains(err.Error(), "Reading Input Failed") {
+		t.Errorf("expected the Input error, got %v", err)
+	}
+	if scraped := results.ScrapedData(); len(scraped) != 2 {
+		t.Errorf("expected 2 scraped records, got %d", len(scraped))
+	}
+}